@@ -0,0 +1,67 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/raythx98/gohelpme/tool/httphelper"
+)
+
+// rewindBody returns a function that yields a fresh copy of the request body on every call.
+//
+// It uses req.GetBody when available, otherwise it buffers the body the same way httphelper.CopyRequestBody does.
+func rewindBody(req *http.Request) func() (io.ReadCloser, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return func() (io.ReadCloser, error) {
+			return http.NoBody, nil
+		}
+	}
+
+	if req.GetBody != nil {
+		return req.GetBody
+	}
+
+	body := httphelper.CopyRequestBody(req)
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(body)), nil
+	}
+}
+
+// cloneRequest returns a copy of req with a fresh body, so that it can be sent again.
+func cloneRequest(req *http.Request, getBody func() (io.ReadCloser, error)) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.Body == nil {
+		return clone, nil
+	}
+
+	body, err := getBody()
+	if err != nil {
+		return nil, err
+	}
+	clone.Body = body
+	return clone, nil
+}
+
+// drainBody discards the remaining response body and closes it, so that the connection can be reused.
+func drainBody(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+}
+
+// cancelOnClose releases the resources of a request, such as its context, once its response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel func()
+	once   sync.Once
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.cancel)
+	return err
+}
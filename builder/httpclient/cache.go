@@ -0,0 +1,345 @@
+package httpclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raythx98/gohelpme/builder/httprequest"
+	"github.com/raythx98/gohelpme/tool/httphelper"
+	"github.com/raythx98/gohelpme/tool/logger"
+)
+
+// cacheableStatusCodes are the status codes that are cacheable by default, as defined by RFC 9110.
+var cacheableStatusCodes = []int{
+	http.StatusOK,
+	http.StatusNonAuthoritativeInfo,
+	http.StatusNoContent,
+	http.StatusMultipleChoices,
+	http.StatusMovedPermanently,
+	http.StatusNotFound,
+	http.StatusMethodNotAllowed,
+	http.StatusGone,
+	http.StatusRequestURITooLong,
+	http.StatusNotImplemented,
+}
+
+// CacheConfig is the configuration for the CacheRoundTripper.
+type CacheConfig struct {
+	// Store holds the cached responses, defaults to an LRUCacheStore of 1000 responses.
+	Store ICacheStore
+	// MaxBodyBytes skips caching responses with larger bodies, 0 caches bodies of any size.
+	MaxBodyBytes int64
+	// Private makes the cache behave as a private cache, caching `private` responses and responses to requests
+	// with an `Authorization` header. Only enable it for a Client whose requests are all made on behalf of the same user.
+	Private bool
+}
+
+// DefaultCacheConfig returns a CacheConfig with an LRUCacheStore of 1000 responses of up to 1MiB each.
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		Store:        NewLRUCacheStore(1000),
+		MaxBodyBytes: 1 << 20,
+	}
+}
+
+// CacheRoundTripper is an http.RoundTripper that caches GET and HEAD responses as described by RFC 9111,
+// honoring Cache-Control, Expires and Vary, and revalidating stale responses with ETag and Last-Modified.
+//
+// It behaves as a shared cache by default, since every caller of the Client shares it:
+// `private` responses are only cached with CacheConfig.Private, and responses to requests with an `Authorization`
+// header only with CacheConfig.Private or if the response allows it with `public`, `s-maxage` or `must-revalidate`.
+type CacheRoundTripper struct {
+	cfg  CacheConfig
+	log  logger.ILogger
+	next http.RoundTripper
+}
+
+// NewCacheRoundTripper creates a new CacheRoundTripper that sends requests through next.
+//
+// If next is nil, http.DefaultTransport is used. Cache hits and misses are logged at debug level through log.
+func NewCacheRoundTripper(cfg CacheConfig, log logger.ILogger, next http.RoundTripper) *CacheRoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewLRUCacheStore(1000)
+	}
+	return &CacheRoundTripper{cfg: cfg, log: log, next: next}
+}
+
+// Cache is a Middleware that caches responses of the next http.RoundTripper.
+func Cache(cfg CacheConfig, log logger.ILogger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewCacheRoundTripper(cfg, log, next)
+	}
+}
+
+// RoundTrip serves the request from the cache if a fresh response is stored,
+// otherwise it executes a single HTTP transaction, revalidating or storing the response.
+func (t *CacheRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := fmt.Sprintf("%s %s", req.Method, req.URL.String())
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.invalidate(req)
+	}
+
+	reqCacheControl := parseCacheControl(req.Header)
+	if _, ok := reqCacheControl["no-store"]; ok || isConditional(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	cached, ok := t.cfg.Store.Get(key)
+	if ok && !varyMatches(cached, req) {
+		cached, ok = nil, false
+	}
+
+	if ok && isFresh(cached, reqCacheControl) {
+		t.logResult(req, "hit")
+		return cached.toResponse(req), nil
+	}
+
+	if ok && hasValidators(cached) {
+		return t.revalidate(req, key, cached)
+	}
+
+	t.logResult(req, "miss")
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	t.store(req, key, resp)
+	return resp, nil
+}
+
+// revalidate sends a conditional request for a stale response, serving it again if the server replies 304 Not Modified.
+func (t *CacheRoundTripper) revalidate(req *http.Request, key string, cached *CachedResponse) (*http.Response, error) {
+	conditionalReq := req.Clone(req.Context())
+	if etag := cached.Header.Get("ETag"); etag != "" {
+		conditionalReq.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+		conditionalReq.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := t.next.RoundTrip(conditionalReq)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode != http.StatusNotModified {
+		t.logResult(req, "miss")
+		t.store(req, key, resp)
+		return resp, nil
+	}
+	drainBody(resp)
+
+	// Stored responses are shared, so a revalidated copy is stored instead of updating it in place
+	revalidated := *cached
+	revalidated.Header = cached.Header.Clone()
+	for name, values := range resp.Header {
+		revalidated.Header[name] = values
+	}
+	revalidated.ResponseTime = time.Now()
+	t.cfg.Store.Set(key, &revalidated)
+
+	t.logResult(req, "revalidated")
+	return revalidated.toResponse(req), nil
+}
+
+// store caches the response if it is cacheable, leaving its body readable by the caller.
+func (t *CacheRoundTripper) store(req *http.Request, key string, resp *http.Response) {
+	if !isCacheable(req, resp, t.cfg.Private) {
+		return
+	}
+
+	body, truncated := httphelper.PeekResponseBody(resp, t.cfg.MaxBodyBytes)
+	if truncated {
+		return
+	}
+
+	varyHeader := http.Header{}
+	for _, name := range varyHeaderNames(resp.Header) {
+		varyHeader[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+	}
+
+	t.cfg.Store.Set(key, &CachedResponse{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         []byte(body),
+		VaryHeader:   varyHeader,
+		ResponseTime: time.Now(),
+	})
+}
+
+// invalidate sends an unsafe request, dropping the cached responses of its URL if it succeeds.
+func (t *CacheRoundTripper) invalidate(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && resp.StatusCode < http.StatusBadRequest {
+		t.cfg.Store.Delete(fmt.Sprintf("%s %s", http.MethodGet, req.URL.String()))
+		t.cfg.Store.Delete(fmt.Sprintf("%s %s", http.MethodHead, req.URL.String()))
+	}
+	return resp, err
+}
+
+func (t *CacheRoundTripper) logResult(req *http.Request, result string) {
+	t.log.Debug(req.Context(), fmt.Sprintf("[http-cache] %s %s %s", result, req.Method, req.URL.String()),
+		logger.WithField("cache", result))
+}
+
+func (c *CachedResponse) toResponse(req *http.Request) *http.Response {
+	header := c.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(c.age().Seconds())))
+
+	body := c.Body
+	if req.Method == http.MethodHead {
+		body = nil
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.StatusCode, http.StatusText(c.StatusCode)),
+		StatusCode:    c.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// age is the current age of the response, as defined by RFC 9111 section 4.2.3.
+func (c *CachedResponse) age() time.Duration {
+	var age time.Duration
+	if date, err := http.ParseTime(c.Header.Get("Date")); err == nil {
+		age = max(c.ResponseTime.Sub(date), 0)
+	}
+	if seconds, err := strconv.Atoi(c.Header.Get("Age")); err == nil {
+		age = max(age, time.Duration(seconds)*time.Second)
+	}
+	return age + time.Since(c.ResponseTime)
+}
+
+// freshnessLifetime is how long the response is fresh for, as defined by RFC 9111 section 4.2.1.
+func (c *CachedResponse) freshnessLifetime() time.Duration {
+	cacheControl := parseCacheControl(c.Header)
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if value, ok := cacheControl[directive]; ok {
+			if seconds, err := strconv.Atoi(value); err == nil {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	expires, err := http.ParseTime(c.Header.Get("Expires"))
+	if err != nil {
+		return 0
+	}
+	date, err := http.ParseTime(c.Header.Get("Date"))
+	if err != nil {
+		date = c.ResponseTime
+	}
+	return expires.Sub(date)
+}
+
+func isFresh(cached *CachedResponse, reqCacheControl map[string]string) bool {
+	if _, ok := reqCacheControl["no-cache"]; ok {
+		return false
+	}
+	if _, ok := parseCacheControl(cached.Header)["no-cache"]; ok {
+		return false
+	}
+
+	lifetime := cached.freshnessLifetime()
+	if value, ok := reqCacheControl["max-age"]; ok {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			lifetime = min(lifetime, time.Duration(seconds)*time.Second)
+		}
+	}
+	return lifetime > cached.age()
+}
+
+func isCacheable(req *http.Request, resp *http.Response, private bool) bool {
+	if !slices.Contains(cacheableStatusCodes, resp.StatusCode) {
+		return false
+	}
+
+	cacheControl := parseCacheControl(resp.Header)
+	if _, ok := cacheControl["no-store"]; ok {
+		return false
+	}
+	if _, ok := cacheControl["private"]; ok && !private {
+		return false
+	}
+	if slices.Contains(varyHeaderNames(resp.Header), "*") {
+		return false
+	}
+
+	_, public := cacheControl["public"]
+	_, sMaxAge := cacheControl["s-maxage"]
+	_, mustRevalidate := cacheControl["must-revalidate"]
+	if req.Header.Get(string(httprequest.Authorization)) != "" && !private && !public && !sMaxAge && !mustRevalidate {
+		return false
+	}
+
+	_, maxAge := cacheControl["max-age"]
+	return public || sMaxAge || maxAge ||
+		resp.Header.Get("Expires") != "" ||
+		resp.Header.Get("ETag") != "" ||
+		resp.Header.Get("Last-Modified") != ""
+}
+
+func hasValidators(cached *CachedResponse) bool {
+	return cached.Header.Get("ETag") != "" || cached.Header.Get("Last-Modified") != ""
+}
+
+func isConditional(req *http.Request) bool {
+	return req.Header.Get("If-None-Match") != "" ||
+		req.Header.Get("If-Modified-Since") != "" ||
+		req.Header.Get("Range") != ""
+}
+
+func varyMatches(cached *CachedResponse, req *http.Request) bool {
+	for name, values := range cached.VaryHeader {
+		if !slices.Equal(values, req.Header.Values(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func varyHeaderNames(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// parseCacheControl parses the Cache-Control directives into a map of lower-cased names to their values.
+func parseCacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	if _, ok := directives["no-cache"]; !ok && header.Get("Pragma") == "no-cache" {
+		directives["no-cache"] = ""
+	}
+	return directives
+}
@@ -0,0 +1,188 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/raythx98/gohelpme/tool/logger"
+)
+
+func TestCacheRoundTripper(t *testing.T) {
+	type request struct {
+		method  string
+		headers map[string]string
+	}
+	get := request{method: http.MethodGet}
+
+	tests := []struct {
+		name                string
+		cfg                 CacheConfig
+		respHeaders         map[string]string
+		requests            []request
+		expectedServerCalls int
+		expectedBodies      []string
+	}{
+		{
+			name:                "Serve fresh response from cache",
+			respHeaders:         map[string]string{"Cache-Control": "max-age=60"},
+			requests:            []request{get, get},
+			expectedServerCalls: 1,
+			expectedBodies:      []string{"v1", "v1"},
+		},
+		{
+			name:                "Do not store no-store response",
+			respHeaders:         map[string]string{"Cache-Control": "no-store, max-age=60"},
+			requests:            []request{get, get},
+			expectedServerCalls: 2,
+			expectedBodies:      []string{"v1", "v2"},
+		},
+		{
+			name:                "Bypass cache for no-cache request",
+			respHeaders:         map[string]string{"Cache-Control": "max-age=60"},
+			requests:            []request{get, {method: http.MethodGet, headers: map[string]string{"Cache-Control": "no-cache"}}},
+			expectedServerCalls: 2,
+			expectedBodies:      []string{"v1", "v2"},
+		},
+		{
+			name:                "Revalidate stale response with ETag",
+			respHeaders:         map[string]string{"Cache-Control": "max-age=0", "ETag": `"abc"`},
+			requests:            []request{get, get},
+			expectedServerCalls: 2,
+			expectedBodies:      []string{"v1", "v1"},
+		},
+		{
+			name:        "Match Vary headers",
+			respHeaders: map[string]string{"Cache-Control": "max-age=60", "Vary": "Accept-Language"},
+			requests: []request{
+				{method: http.MethodGet, headers: map[string]string{"Accept-Language": "en"}},
+				{method: http.MethodGet, headers: map[string]string{"Accept-Language": "en"}},
+				{method: http.MethodGet, headers: map[string]string{"Accept-Language": "fr"}},
+			},
+			expectedServerCalls: 2,
+			expectedBodies:      []string{"v1", "v1", "v2"},
+		},
+		{
+			name:                "Invalidate on successful unsafe request",
+			respHeaders:         map[string]string{"Cache-Control": "max-age=60"},
+			requests:            []request{get, {method: http.MethodPost}, get},
+			expectedServerCalls: 3,
+			expectedBodies:      []string{"v1", "v2", "v3"},
+		},
+		{
+			name:                "Do not store private response in shared cache",
+			respHeaders:         map[string]string{"Cache-Control": "private, max-age=60"},
+			requests:            []request{get, get},
+			expectedServerCalls: 2,
+			expectedBodies:      []string{"v1", "v2"},
+		},
+		{
+			name:                "Store private response in private cache",
+			cfg:                 CacheConfig{Private: true},
+			respHeaders:         map[string]string{"Cache-Control": "private, max-age=60"},
+			requests:            []request{get, get},
+			expectedServerCalls: 1,
+			expectedBodies:      []string{"v1", "v1"},
+		},
+		{
+			name:        "Do not store authorized response in shared cache",
+			respHeaders: map[string]string{"Cache-Control": "max-age=60"},
+			requests: []request{
+				{method: http.MethodGet, headers: map[string]string{"Authorization": "Bearer token"}},
+				{method: http.MethodGet, headers: map[string]string{"Authorization": "Bearer token"}},
+			},
+			expectedServerCalls: 2,
+			expectedBodies:      []string{"v1", "v2"},
+		},
+		{
+			name:        "Store authorized public response in shared cache",
+			respHeaders: map[string]string{"Cache-Control": "public, max-age=60"},
+			requests: []request{
+				{method: http.MethodGet, headers: map[string]string{"Authorization": "Bearer token"}},
+				{method: http.MethodGet, headers: map[string]string{"Authorization": "Bearer token"}},
+			},
+			expectedServerCalls: 1,
+			expectedBodies:      []string{"v1", "v1"},
+		},
+		{
+			name:        "Store authorized response in private cache",
+			cfg:         CacheConfig{Private: true},
+			respHeaders: map[string]string{"Cache-Control": "max-age=60"},
+			requests: []request{
+				{method: http.MethodGet, headers: map[string]string{"Authorization": "Bearer token"}},
+				{method: http.MethodGet, headers: map[string]string{"Authorization": "Bearer token"}},
+			},
+			expectedServerCalls: 1,
+			expectedBodies:      []string{"v1", "v1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var serverCalls int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverCalls++
+				for k, v := range tt.respHeaders {
+					w.Header().Set(k, v)
+				}
+				if etag := tt.respHeaders["ETag"]; etag != "" && r.Header.Get("If-None-Match") == etag {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				_, _ = fmt.Fprintf(w, "v%d", serverCalls)
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: NewCacheRoundTripper(tt.cfg, logger.NewDefault(), nil)}
+
+			var bodies []string
+			for _, r := range tt.requests {
+				req, _ := http.NewRequest(r.method, server.URL, nil)
+				for k, v := range r.headers {
+					req.Header.Set(k, v)
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				_ = resp.Body.Close()
+				bodies = append(bodies, string(body))
+			}
+
+			if serverCalls != tt.expectedServerCalls {
+				t.Errorf("expected %d server calls, got %d", tt.expectedServerCalls, serverCalls)
+			}
+			if !slices.Equal(bodies, tt.expectedBodies) {
+				t.Errorf("expected bodies %v, got %v", tt.expectedBodies, bodies)
+			}
+		})
+	}
+}
+
+func TestLRUCacheStore(t *testing.T) {
+	store := NewLRUCacheStore(2)
+	store.Set("a", &CachedResponse{StatusCode: http.StatusOK})
+	store.Set("b", &CachedResponse{StatusCode: http.StatusOK})
+	store.Get("a")
+	store.Set("c", &CachedResponse{StatusCode: http.StatusOK})
+
+	tests := []struct {
+		key        string
+		expectedOk bool
+	}{
+		{key: "a", expectedOk: true},
+		{key: "b", expectedOk: false},
+		{key: "c", expectedOk: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if _, ok := store.Get(tt.key); ok != tt.expectedOk {
+				t.Errorf("expected %s cached %v, got %v", tt.key, tt.expectedOk, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package httpclient
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ICacheStore is the interface for storing the responses of the CacheRoundTripper.
+type ICacheStore interface {
+	// Get returns the response stored under key.
+	Get(key string) (*CachedResponse, bool)
+	// Set stores the response under key, replacing any existing one.
+	Set(key string, resp *CachedResponse)
+	// Delete removes the response stored under key.
+	Delete(key string)
+}
+
+// CachedResponse is a response stored by the CacheRoundTripper.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// VaryHeader holds the request headers named by the Vary response header, which must match to reuse the response.
+	VaryHeader http.Header
+	// ResponseTime is when the response was received or last revalidated.
+	ResponseTime time.Time
+}
+
+// LRUCacheStore is an in-memory ICacheStore that evicts the least recently used response once full.
+type LRUCacheStore struct {
+	capacity int
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key  string
+	resp *CachedResponse
+}
+
+// NewLRUCacheStore creates a new LRUCacheStore that holds up to capacity responses.
+func NewLRUCacheStore(capacity int) *LRUCacheStore {
+	return &LRUCacheStore{
+		capacity: max(capacity, 1),
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (s *LRUCacheStore) Get(key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.order.MoveToFront(element)
+	return element.Value.(*lruEntry).resp, true
+}
+
+func (s *LRUCacheStore) Set(key string, resp *CachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.items[key]; ok {
+		element.Value.(*lruEntry).resp = resp
+		s.order.MoveToFront(element)
+		return
+	}
+
+	s.items[key] = s.order.PushFront(&lruEntry{key: key, resp: resp})
+	if s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (s *LRUCacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.items[key]; ok {
+		s.order.Remove(element)
+		delete(s.items, key)
+	}
+}
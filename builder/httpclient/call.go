@@ -0,0 +1,145 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/raythx98/gohelpme/builder/httprequest"
+	"github.com/raythx98/gohelpme/errorhelper"
+)
+
+// CallRequest describes a request sent by Call.
+type CallRequest[Req any] struct {
+	Method httprequest.Method
+	// Url may contain `{name}` placeholders, which are replaced by the escaped PathParams.
+	Url        string
+	PathParams map[string]string
+	Query      map[string]string
+	// Body is encoded by the httprequest.Codec of ContentType, nil sends no body.
+	Body *Req
+	// ContentType defaults to `application/json`.
+	ContentType httprequest.ContentType
+	Headers     map[string]string
+	// Auth sets the `Authorization` header, empty sends no header.
+	Auth string
+	// ExpectedStatusCodes are the status codes treated as success, defaults to any 2xx.
+	ExpectedStatusCodes []int
+}
+
+// ResponseError is returned by Call when the response status code is not expected.
+type ResponseError struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// ErrorResponse is the decoded body if it is an errorhelper.ErrorResponse, as returned by our own services.
+	ErrorResponse *errorhelper.ErrorResponse
+}
+
+func (e *ResponseError) Error() string {
+	if e.ErrorResponse != nil {
+		return fmt.Sprintf("Response Error, Status: %d, Message: %s, Code: %d", e.StatusCode, e.ErrorResponse.Message, e.ErrorResponse.Code)
+	}
+	return fmt.Sprintf("Response Error, Status: %d, Body: %s", e.StatusCode, string(e.Body))
+}
+
+// Decode decodes the error response body into v with the httprequest.Codec of its `Content-Type`.
+func (e *ResponseError) Decode(v any) error {
+	return decodeBody(e.Header, e.Body, v)
+}
+
+// DecodeError decodes the body of a *ResponseError in err into E.
+//
+// It returns false if err is not a *ResponseError, or if its body cannot be decoded into E.
+func DecodeError[E any](err error) (E, bool) {
+	var body E
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) {
+		return body, false
+	}
+	if err := respErr.Decode(&body); err != nil {
+		return body, false
+	}
+	return body, true
+}
+
+// Call builds a request with httprequest.Builder, sends it with client and decodes the response body into Resp
+// with the httprequest.Codec of its `Content-Type`, defaulting to JSON.
+//
+// Unexpected status codes are returned as a *ResponseError carrying the status, headers and raw body.
+// An empty response body leaves Resp as its zero value.
+//
+// Example:
+//
+//	user, err := httpclient.Call[CreateUserRequest, User](ctx, client, httpclient.CallRequest[CreateUserRequest]{
+//		Method: httprequest.Post,
+//		Url:    "https://example.com/users",
+//		Body:   &CreateUserRequest{Name: "name"},
+//	})
+func Call[Req any, Resp any](ctx context.Context, client IClient, r CallRequest[Req]) (Resp, error) {
+	var result Resp
+
+	builder := (&httprequest.Builder{}).New(ctx, r.Method, r.Url).
+		WithPathParams(r.PathParams).
+		WithQuery(r.Query).
+		WithHeaders(r.Headers)
+	if r.Auth != "" {
+		builder = builder.WithAuth(r.Auth)
+	}
+	if r.Body != nil {
+		if r.ContentType != "" {
+			builder = builder.WithContentType(r.ContentType)
+		}
+		builder = builder.WithBody(r.Body)
+	}
+
+	req, err := builder.Build()
+	if err != nil {
+		return result, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return result, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if !isExpectedStatus(resp.StatusCode, r.ExpectedStatusCodes) {
+		return result, newResponseError(resp, body)
+	}
+
+	if err := decodeBody(resp.Header, body, &result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func isExpectedStatus(statusCode int, expected []int) bool {
+	if len(expected) == 0 {
+		return statusCode >= 200 && statusCode < 300
+	}
+	return slices.Contains(expected, statusCode)
+}
+
+func newResponseError(resp *http.Response, body []byte) *ResponseError {
+	respErr := &ResponseError{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+	}
+
+	var errorResponse errorhelper.ErrorResponse
+	if err := json.Unmarshal(body, &errorResponse); err == nil && errorResponse.Message != "" && errorResponse.Code != 0 {
+		respErr.ErrorResponse = &errorResponse
+	}
+	return respErr
+}
@@ -0,0 +1,180 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/raythx98/gohelpme/builder/httprequest"
+)
+
+type callTestUser struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestCall(t *testing.T) {
+	tests := []struct {
+		name                  string
+		respStatus            int
+		respContentType       string
+		respBody              string
+		expectedStatusCodes   []int
+		expectedUser          callTestUser
+		expectedErr           error
+		expectedErrorStatus   int
+		expectedErrorResponse bool
+	}{
+		{
+			name:         "Decode successful response",
+			respStatus:   http.StatusCreated,
+			respBody:     `{"id":1,"name":"alice"}`,
+			expectedUser: callTestUser{Id: 1, Name: "alice"},
+		},
+		{
+			name:            "Reject content type without codec",
+			respStatus:      http.StatusOK,
+			respContentType: "application/x-protobuf",
+			respBody:        `{"id":1,"name":"alice"}`,
+			expectedErr:     httprequest.ErrNoCodec,
+		},
+		{
+			name:       "Leave zero value for empty body",
+			respStatus: http.StatusNoContent,
+		},
+		{
+			name:                  "Return ResponseError with decoded ErrorResponse",
+			respStatus:            http.StatusUnprocessableEntity,
+			respBody:              `{"message":"invalid name","code":422}`,
+			expectedErrorStatus:   http.StatusUnprocessableEntity,
+			expectedErrorResponse: true,
+		},
+		{
+			name:                "Return ResponseError without ErrorResponse for other payloads",
+			respStatus:          http.StatusBadGateway,
+			respBody:            `<html>bad gateway</html>`,
+			expectedErrorStatus: http.StatusBadGateway,
+		},
+		{
+			name:                "Reject status not in ExpectedStatusCodes",
+			respStatus:          http.StatusOK,
+			respBody:            `{"id":1}`,
+			expectedStatusCodes: []int{http.StatusCreated},
+			expectedErrorStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != `{"id":0,"name":"alice"}` {
+					t.Errorf("unexpected request body %s", string(body))
+				}
+				if r.URL.Path != "/users/42" || r.URL.Query().Get("notify") != "true" {
+					t.Errorf("unexpected request url %s", r.URL.String())
+				}
+				contentType := tt.respContentType
+				if contentType == "" {
+					contentType = "application/json"
+				}
+				w.Header().Set("Content-Type", contentType)
+				w.WriteHeader(tt.respStatus)
+				_, _ = w.Write([]byte(tt.respBody))
+			}))
+			defer server.Close()
+
+			user, err := Call[callTestUser, callTestUser](context.Background(), http.DefaultClient, CallRequest[callTestUser]{
+				Method:              httprequest.Put,
+				Url:                 server.URL + "/users/{id}",
+				PathParams:          map[string]string{"id": "42"},
+				Query:               map[string]string{"notify": "true"},
+				Body:                &callTestUser{Name: "alice"},
+				ExpectedStatusCodes: tt.expectedStatusCodes,
+			})
+
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if tt.expectedErrorStatus == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if user != tt.expectedUser {
+					t.Errorf("expected user %+v, got %+v", tt.expectedUser, user)
+				}
+				return
+			}
+
+			var respErr *ResponseError
+			if !errors.As(err, &respErr) {
+				t.Fatalf("expected *ResponseError, got %v", err)
+			}
+			if respErr.StatusCode != tt.expectedErrorStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedErrorStatus, respErr.StatusCode)
+			}
+			if (respErr.ErrorResponse != nil) != tt.expectedErrorResponse {
+				t.Errorf("expected ErrorResponse %v, got %+v", tt.expectedErrorResponse, respErr.ErrorResponse)
+			}
+			if string(respErr.Body) != tt.respBody {
+				t.Errorf("expected raw body %q, got %q", tt.respBody, string(respErr.Body))
+			}
+		})
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	type problem struct {
+		Title string `json:"title"`
+	}
+
+	tests := []struct {
+		name          string
+		err           error
+		expectedOk    bool
+		expectedTitle string
+	}{
+		{
+			name: "Decode body of ResponseError",
+			err: &ResponseError{
+				StatusCode: http.StatusBadRequest,
+				Header:     http.Header{"Content-Type": []string{"application/problem+json"}},
+				Body:       []byte(`{"title":"bad input"}`),
+			},
+			expectedOk:    true,
+			expectedTitle: "bad input",
+		},
+		{
+			name: "Reject body of content type without codec",
+			err: &ResponseError{
+				StatusCode: http.StatusBadRequest,
+				Header:     http.Header{"Content-Type": []string{"application/x-protobuf"}},
+				Body:       []byte(`{"title":"bad input"}`),
+			},
+			expectedOk: false,
+		},
+		{
+			name:       "Reject other errors",
+			err:        errors.New("connection refused"),
+			expectedOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, ok := DecodeError[problem](tt.err)
+			if ok != tt.expectedOk {
+				t.Errorf("expected ok %v, got %v", tt.expectedOk, ok)
+			}
+			if body.Title != tt.expectedTitle {
+				t.Errorf("expected title %q, got %q", tt.expectedTitle, body.Title)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package httpclient
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Middleware wraps an http.RoundTripper with additional behaviour, such as logging, retries or auth.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// Chain is a variadic function that takes a base http.RoundTripper and a list of Middleware.
+// It returns an http.RoundTripper that chains the middlewares together in the order they are provided.
+// The first middleware in the list is the outermost one, which sees the request first and the response last.
+// And the last middleware in the list is the innermost one, which calls the base transport directly.
+//
+// If base is nil, http.DefaultTransport is used.
+//
+// Example:
+//
+//	transport := httpclient.Chain(http.DefaultTransport,
+//		httpclient.Retry(httpclient.DefaultRetryConfig()),
+//		httpclient.Log(log, httpclient.DefaultLogConfig()),
+//	)
+func Chain(base http.RoundTripper, m ...Middleware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	middlewares := slices.Clone(m)
+	slices.Reverse(middlewares)
+
+	finalTransport := base
+	for _, candidate := range middlewares {
+		finalTransport = candidate(finalTransport)
+	}
+	return finalTransport
+}
@@ -0,0 +1,114 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// roundTripperFunc adapts a function to an http.RoundTripper.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newResponse returns a response to req with the given status and body.
+func newResponse(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode:    status,
+		Status:        http.StatusText(status),
+		Header:        make(http.Header),
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// recordingMiddleware appends name to calls when the request passes through it and again when the response does.
+func recordingMiddleware(name string, calls *[]string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			*calls = append(*calls, name+" request")
+			resp, err := next.RoundTrip(req)
+			*calls = append(*calls, name+" response")
+			return resp, err
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	tests := []struct {
+		name          string
+		middlewares   []string
+		expectedCalls []string
+	}{
+		{
+			name:          "Call base without middlewares",
+			expectedCalls: []string{"base"},
+		},
+		{
+			name:          "Wrap base with a single middleware",
+			middlewares:   []string{"a"},
+			expectedCalls: []string{"a request", "base", "a response"},
+		},
+		{
+			name:          "Call first middleware outermost",
+			middlewares:   []string{"a", "b", "c"},
+			expectedCalls: []string{"a request", "b request", "c request", "base", "c response", "b response", "a response"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, "base")
+				return newResponse(req, http.StatusOK, ""), nil
+			})
+
+			var middlewares []Middleware
+			for _, name := range tt.middlewares {
+				middlewares = append(middlewares, recordingMiddleware(name, &calls))
+			}
+
+			resp, err := Chain(base, middlewares...).RoundTrip(httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_ = resp.Body.Close()
+
+			if !slices.Equal(calls, tt.expectedCalls) {
+				t.Errorf("expected calls %v, got %v", tt.expectedCalls, calls)
+			}
+		})
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "server")
+	}))
+	defer server.Close()
+
+	client := NewWithOptions(
+		WithMiddlewares(recordingMiddleware("a", &calls)),
+		WithMiddlewares(recordingMiddleware("b", &calls)),
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	expectedCalls := []string{"a request", "b request", "server", "b response", "a response"}
+	if !slices.Equal(calls, expectedCalls) {
+		t.Errorf("expected calls %v, got %v", expectedCalls, calls)
+	}
+}
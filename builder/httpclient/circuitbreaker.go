@@ -0,0 +1,288 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/raythx98/gohelpme/tool/logger"
+)
+
+// ErrCircuitOpen is returned, wrapped in a CircuitOpenError, when a request is rejected by the circuit breaker.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker.
+// It can be either CircuitClosed, CircuitOpen or CircuitHalfOpen.
+type CircuitState string
+
+const (
+	// CircuitClosed lets every request through while counting failures.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen rejects every request until the cool-down elapses.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a limited number of probe requests through to test the host.
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitBreakerConfig is the configuration for the CircuitBreakerRoundTripper.
+type CircuitBreakerConfig struct {
+	// ConsecutiveFailures opens the circuit after this many consecutive failures, 0 disables the trigger.
+	ConsecutiveFailures int
+	// FailureRatio opens the circuit when the ratio of failures within Window reaches it, 0 disables the trigger.
+	FailureRatio float64
+	// MinRequests is the minimum number of requests within Window before FailureRatio is evaluated.
+	MinRequests int
+	// Window is the interval after which the failure counts of a closed circuit are reset.
+	Window time.Duration
+	// CoolDown is how long the circuit stays open before probe requests are allowed.
+	CoolDown time.Duration
+	// HalfOpenProbes is the number of probe requests allowed while half-open, all of which must succeed to close the circuit.
+	HalfOpenProbes int
+	// IsFailure reports whether the result of a request counts as a failure, defaults to IsCircuitFailure.
+	IsFailure func(resp *http.Response, err error) bool
+}
+
+// DefaultCircuitBreakerConfig returns a CircuitBreakerConfig with sensible defaults.
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		ConsecutiveFailures: 5,
+		FailureRatio:        0.5,
+		MinRequests:         20,
+		Window:              time.Minute,
+		CoolDown:            30 * time.Second,
+		HalfOpenProbes:      1,
+		IsFailure:           IsCircuitFailure,
+	}
+}
+
+// CircuitOpenError is returned when a request is rejected because the circuit of its host is not closed.
+type CircuitOpenError struct {
+	Host    string
+	State   CircuitState
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v, Host: %s, State: %s, RetryAt: %s", ErrCircuitOpen, e.Host, e.State, e.RetryAt.Format(time.RFC3339))
+}
+
+// Unwrap allows errors.Is(err, ErrCircuitOpen).
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// IsCircuitFailure reports whether a request failed because of the host, i.e. a transport error or a 5xx response.
+//
+// Requests cancelled by the caller are not counted as failures,
+// the CircuitBreakerRoundTripper does not count them at all as the host never answered.
+func IsCircuitFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return resp != nil && resp.StatusCode >= http.StatusInternalServerError
+}
+
+// CircuitBreakerRoundTripper is an http.RoundTripper that keeps a circuit breaker per host,
+// rejecting requests to hosts that keep failing.
+type CircuitBreakerRoundTripper struct {
+	cfg  CircuitBreakerConfig
+	log  logger.ILogger
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state       CircuitState
+	generation  uint64
+	openedAt    time.Time
+	windowStart time.Time
+
+	requests            int
+	failures            int
+	consecutiveFailures int
+	probesInFlight      int
+	probeSuccesses      int
+}
+
+// NewCircuitBreakerRoundTripper creates a new CircuitBreakerRoundTripper that sends requests through next.
+//
+// If next is nil, http.DefaultTransport is used. State changes are logged through log.
+func NewCircuitBreakerRoundTripper(cfg CircuitBreakerConfig, log logger.ILogger, next http.RoundTripper) *CircuitBreakerRoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = IsCircuitFailure
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+	return &CircuitBreakerRoundTripper{
+		cfg:      cfg,
+		log:      log,
+		next:     next,
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// CircuitBreaker is a Middleware that guards the next http.RoundTripper with a circuit breaker per host.
+func CircuitBreaker(cfg CircuitBreakerConfig, log logger.ILogger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewCircuitBreakerRoundTripper(cfg, log, next)
+	}
+}
+
+// RoundTrip executes a single HTTP transaction, or returns a *CircuitOpenError if the circuit of the host is not closed.
+func (t *CircuitBreakerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+
+	generation, err := t.allow(req.Context(), host)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if errors.Is(err, context.Canceled) {
+		t.release(host, generation)
+		return resp, err
+	}
+	t.record(req.Context(), host, generation, t.cfg.IsFailure(resp, err))
+	return resp, err
+}
+
+// State returns the current state of the circuit of the given host.
+func (t *CircuitBreakerRoundTripper) State(host string) CircuitState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if c, ok := t.circuits[host]; ok {
+		return c.state
+	}
+	return CircuitClosed
+}
+
+// allow checks whether a request to host may be sent, returning the generation of the circuit it was admitted in.
+func (t *CircuitBreakerRoundTripper) allow(ctx context.Context, host string) (uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	c, ok := t.circuits[host]
+	if !ok {
+		c = &circuit{state: CircuitClosed, windowStart: now}
+		t.circuits[host] = c
+	}
+
+	switch c.state {
+	case CircuitClosed:
+		if t.cfg.Window > 0 && now.Sub(c.windowStart) >= t.cfg.Window {
+			c.resetCounts(now)
+		}
+		return c.generation, nil
+	case CircuitOpen:
+		if now.Before(c.openedAt.Add(t.cfg.CoolDown)) {
+			return 0, &CircuitOpenError{Host: host, State: c.state, RetryAt: c.openedAt.Add(t.cfg.CoolDown)}
+		}
+		t.transition(ctx, host, c, CircuitHalfOpen, now)
+	}
+
+	if c.probesInFlight+c.probeSuccesses >= t.cfg.HalfOpenProbes {
+		return 0, &CircuitOpenError{Host: host, State: c.state, RetryAt: now.Add(t.cfg.CoolDown)}
+	}
+	c.probesInFlight++
+	return c.generation, nil
+}
+
+// record updates the circuit of host with the result of a request admitted in the given generation.
+//
+// Results of requests admitted before the last state change are ignored.
+func (t *CircuitBreakerRoundTripper) record(ctx context.Context, host string, generation uint64, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := t.circuits[host]
+	if c.generation != generation {
+		return
+	}
+
+	now := time.Now()
+	switch c.state {
+	case CircuitHalfOpen:
+		c.probesInFlight--
+		if failed {
+			t.transition(ctx, host, c, CircuitOpen, now)
+			return
+		}
+		if c.probeSuccesses++; c.probeSuccesses >= t.cfg.HalfOpenProbes {
+			t.transition(ctx, host, c, CircuitClosed, now)
+		}
+	case CircuitClosed:
+		c.requests++
+		if !failed {
+			c.consecutiveFailures = 0
+			return
+		}
+		c.failures++
+		c.consecutiveFailures++
+		if t.shouldOpen(c) {
+			t.transition(ctx, host, c, CircuitOpen, now)
+		}
+	}
+}
+
+// release frees the probe slot of a request admitted in the given generation without recording a result,
+// so that a cancelled probe leaves the state of the circuit unchanged.
+func (t *CircuitBreakerRoundTripper) release(host string, generation uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := t.circuits[host]
+	if c.generation == generation && c.state == CircuitHalfOpen {
+		c.probesInFlight--
+	}
+}
+
+func (t *CircuitBreakerRoundTripper) shouldOpen(c *circuit) bool {
+	if t.cfg.ConsecutiveFailures > 0 && c.consecutiveFailures >= t.cfg.ConsecutiveFailures {
+		return true
+	}
+	return t.cfg.FailureRatio > 0 &&
+		c.requests >= t.cfg.MinRequests &&
+		float64(c.failures)/float64(c.requests) >= t.cfg.FailureRatio
+}
+
+func (t *CircuitBreakerRoundTripper) transition(ctx context.Context, host string, c *circuit, to CircuitState, now time.Time) {
+	from := c.state
+	c.state = to
+	c.generation++
+	c.resetCounts(now)
+	if to == CircuitOpen {
+		c.openedAt = now
+	}
+
+	message := fmt.Sprintf("[circuit-breaker] %s: %s -> %s", host, from, to)
+	fields := []logger.Field{
+		logger.WithField("host", host),
+		logger.WithField("from", from),
+		logger.WithField("to", to),
+	}
+	if to == CircuitOpen {
+		t.log.Warn(ctx, message, fields...)
+		return
+	}
+	t.log.Info(ctx, message, fields...)
+}
+
+func (c *circuit) resetCounts(now time.Time) {
+	c.windowStart = now
+	c.requests = 0
+	c.failures = 0
+	c.consecutiveFailures = 0
+	c.probesInFlight = 0
+	c.probeSuccesses = 0
+}
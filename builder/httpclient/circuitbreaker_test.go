@@ -0,0 +1,119 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/raythx98/gohelpme/tool/logger"
+)
+
+func TestCircuitBreakerRoundTripper(t *testing.T) {
+	const (
+		ok       = "ok"
+		fail     = "fail"
+		cancel   = "cancel"
+		coolDown = "cool down"
+	)
+
+	tests := []struct {
+		name             string
+		cfg              CircuitBreakerConfig
+		steps            []string
+		expectedRejected int
+		expectedState    CircuitState
+	}{
+		{
+			name:          "Stay closed when a success resets consecutive failures",
+			steps:         []string{fail, ok, fail},
+			expectedState: CircuitClosed,
+		},
+		{
+			name:             "Open after consecutive failures and reject until cool down",
+			steps:            []string{fail, fail, ok, ok},
+			expectedRejected: 2,
+			expectedState:    CircuitOpen,
+		},
+		{
+			name:          "Open on failure ratio",
+			cfg:           CircuitBreakerConfig{FailureRatio: 0.5, MinRequests: 4, Window: time.Minute},
+			steps:         []string{ok, fail, ok, fail},
+			expectedState: CircuitOpen,
+		},
+		{
+			name:          "Close after successful probe",
+			steps:         []string{fail, fail, coolDown, ok},
+			expectedState: CircuitClosed,
+		},
+		{
+			name:          "Reopen after failed probe",
+			steps:         []string{fail, fail, coolDown, fail},
+			expectedState: CircuitOpen,
+		},
+		{
+			name:          "Keep half-open after cancelled probe",
+			steps:         []string{fail, fail, coolDown, cancel},
+			expectedState: CircuitHalfOpen,
+		},
+		{
+			name:          "Release probe slot of cancelled probe",
+			steps:         []string{fail, fail, coolDown, cancel, ok},
+			expectedState: CircuitClosed,
+		},
+		{
+			name:          "Do not count cancelled requests while closed",
+			steps:         []string{fail, cancel, fail},
+			expectedState: CircuitOpen,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			if cfg.ConsecutiveFailures == 0 && cfg.FailureRatio == 0 {
+				cfg = CircuitBreakerConfig{ConsecutiveFailures: 2}
+			}
+			cfg.CoolDown = 20 * time.Millisecond
+
+			var outcome string
+			next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				switch outcome {
+				case fail:
+					return newResponse(req, http.StatusInternalServerError, ""), nil
+				case cancel:
+					return nil, context.Canceled
+				}
+				return newResponse(req, http.StatusOK, ""), nil
+			})
+			breaker := NewCircuitBreakerRoundTripper(cfg, logger.NewDefault(), next)
+
+			var rejected int
+			for _, step := range tt.steps {
+				if step == coolDown {
+					time.Sleep(cfg.CoolDown)
+					continue
+				}
+
+				outcome = step
+				resp, err := breaker.RoundTrip(httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+				if errors.Is(err, ErrCircuitOpen) {
+					rejected++
+					continue
+				}
+				if resp != nil {
+					_ = resp.Body.Close()
+				}
+			}
+
+			if rejected != tt.expectedRejected {
+				t.Errorf("expected %d rejected requests, got %d", tt.expectedRejected, rejected)
+			}
+			if state := breaker.State("example.com"); state != tt.expectedState {
+				t.Errorf("expected state %s, got %s", tt.expectedState, state)
+			}
+		})
+	}
+}
@@ -5,15 +5,64 @@ import (
 	"net/http"
 )
 
+// IClient is the interface that wraps the Do method, satisfied by both *Client and *http.Client.
+type IClient interface {
+	// Do sends an HTTP request and returns an HTTP response.
+	Do(req *http.Request) (*http.Response, error)
+}
+
 // Client is a wrapper around http.Client that logs requests and responses.
 type Client struct {
-	httpClient *http.Client // TODO: Create a IHttpClient interface
+	httpClient *http.Client
+}
+
+// Option configures the Client created by NewWithOptions.
+type Option func(*options)
+
+type options struct {
+	baseTransport http.RoundTripper
+	middlewares   []Middleware
+}
+
+// WithBaseTransport sets the transport that performs the actual HTTP transaction, defaults to http.DefaultTransport.
+func WithBaseTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.baseTransport = transport
+	}
+}
+
+// WithMiddlewares appends middlewares around the base transport, see Chain for the ordering.
+func WithMiddlewares(middlewares ...Middleware) Option {
+	return func(o *options) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
 }
 
 // New creates a new Client.
+//
+// It forwards the request ID of the originating request, and logs requests and responses.
 func New(log logger.ILogger) *Client {
+	return NewWithOptions(WithMiddlewares(Propagate(DefaultPropagationConfig()), Log(log, DefaultLogConfig())))
+}
+
+// NewWithOptions creates a new Client whose transport is built from the given options.
+//
+// Example:
+//
+//	client := httpclient.NewWithOptions(
+//		httpclient.WithMiddlewares(
+//			httpclient.Retry(httpclient.DefaultRetryConfig()),
+//			httpclient.Log(log, httpclient.DefaultLogConfig()),
+//		),
+//	)
+func NewWithOptions(opts ...Option) *Client {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	httpClient := &http.Client{
-		Transport: NewLogRoundTripper(log),
+		Transport: Chain(o.baseTransport, o.middlewares...),
 	}
 	return &Client{httpClient: httpClient}
 }
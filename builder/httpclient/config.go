@@ -0,0 +1,264 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ConfigProvider is the interface for providing the http client configurations.
+type ConfigProvider interface {
+	GetHttpClientConfig() TransportConfig
+}
+
+// TransportConfig is the configuration for the connections, timeouts and TLS of outbound requests.
+type TransportConfig struct {
+	// Timeout limits the whole request, including reading the response body, 0 means no timeout.
+	Timeout               time.Duration `yaml:"timeout" json:"timeout"`
+	DialTimeout           time.Duration `yaml:"dialTimeout" json:"dialTimeout"`
+	KeepAlive             time.Duration `yaml:"keepAlive" json:"keepAlive"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tlsHandshakeTimeout" json:"tlsHandshakeTimeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"responseHeaderTimeout" json:"responseHeaderTimeout"`
+	IdleConnTimeout       time.Duration `yaml:"idleConnTimeout" json:"idleConnTimeout"`
+	MaxIdleConns          int           `yaml:"maxIdleConns" json:"maxIdleConns"`
+	MaxIdleConnsPerHost   int           `yaml:"maxIdleConnsPerHost" json:"maxIdleConnsPerHost"`
+	MaxConnsPerHost       int           `yaml:"maxConnsPerHost" json:"maxConnsPerHost"`
+
+	// ProxyUrl routes requests through the given proxy, empty uses the HTTP_PROXY and HTTPS_PROXY environment variables.
+	ProxyUrl string `yaml:"proxyUrl" json:"proxyUrl"`
+	// DisableProxy ignores the proxy environment variables.
+	DisableProxy bool `yaml:"disableProxy" json:"disableProxy"`
+
+	// RootCAs are PEM encoded certificates trusted in addition to the system pool.
+	RootCAs [][]byte `yaml:"rootCAs" json:"rootCAs"`
+	// ClientCertificate and ClientKey are the PEM encoded key pair presented for mTLS.
+	ClientCertificate  []byte `yaml:"clientCertificate" json:"clientCertificate"`
+	ClientKey          []byte `yaml:"clientKey" json:"clientKey"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify" json:"insecureSkipVerify"`
+
+	// Hosts overrides the configuration per host, keyed by host or host:port.
+	// Zero fields inherit the configuration above, and nested Hosts are ignored.
+	Hosts map[string]TransportConfig `yaml:"hosts" json:"hosts"`
+}
+
+// DefaultTransportConfig returns a TransportConfig based on the http.DefaultTransport settings,
+// with bounded request and response header timeouts, and up to 10 idle connections per host instead of 2.
+func DefaultTransportConfig() TransportConfig {
+	return TransportConfig{
+		Timeout:               30 * time.Second,
+		DialTimeout:           30 * time.Second,
+		KeepAlive:             30 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+	}
+}
+
+// HostTransport is an http.RoundTripper that sends requests through an http.Transport configured for their host.
+type HostTransport struct {
+	defaultTransport *http.Transport
+	defaultTimeout   time.Duration
+	hosts            map[string]*hostTransport
+}
+
+type hostTransport struct {
+	transport *http.Transport
+	timeout   time.Duration
+}
+
+// NewHostTransport creates a new HostTransport from the configuration.
+//
+// It returns an error if a proxy URL, certificate or key cannot be parsed.
+func NewHostTransport(cfg ConfigProvider) (*HostTransport, error) {
+	config := cfg.GetHttpClientConfig()
+
+	defaultTransport, err := newTransport(config)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make(map[string]*hostTransport, len(config.Hosts))
+	for host, override := range config.Hosts {
+		hostConfig := override.inherit(config)
+		transport, err := newTransport(hostConfig)
+		if err != nil {
+			return nil, fmt.Errorf("host %s: %w", host, err)
+		}
+		hosts[host] = &hostTransport{transport: transport, timeout: hostConfig.Timeout}
+	}
+
+	return &HostTransport{
+		defaultTransport: defaultTransport,
+		defaultTimeout:   config.Timeout,
+		hosts:            hosts,
+	}, nil
+}
+
+// NewFromConfig creates a new Client whose base transport is a HostTransport built from the configuration.
+//
+// Options are applied after the base transport is set, see NewWithOptions.
+func NewFromConfig(cfg ConfigProvider, opts ...Option) (*Client, error) {
+	transport, err := NewHostTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithOptions(append([]Option{WithBaseTransport(transport)}, opts...)...), nil
+}
+
+// RoundTrip executes a single HTTP transaction through the transport of the request host, enforcing its Timeout.
+func (t *HostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport, timeout := t.defaultTransport, t.defaultTimeout
+	if host, ok := t.hosts[req.URL.Host]; ok {
+		transport, timeout = host.transport, host.timeout
+	} else if host, ok := t.hosts[req.URL.Hostname()]; ok {
+		transport, timeout = host.transport, host.timeout
+	}
+
+	if timeout <= 0 {
+		return transport.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// The timeout covers reading the body, so it is only released once the body is closed
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of every host, called by http.Client.CloseIdleConnections.
+func (t *HostTransport) CloseIdleConnections() {
+	t.defaultTransport.CloseIdleConnections()
+	for _, host := range t.hosts {
+		host.transport.CloseIdleConnections()
+	}
+}
+
+// inherit returns the configuration with its zero fields taken from parent.
+func (c TransportConfig) inherit(parent TransportConfig) TransportConfig {
+	inherited := parent
+	inherited.Hosts = nil
+
+	if c.Timeout != 0 {
+		inherited.Timeout = c.Timeout
+	}
+	if c.DialTimeout != 0 {
+		inherited.DialTimeout = c.DialTimeout
+	}
+	if c.KeepAlive != 0 {
+		inherited.KeepAlive = c.KeepAlive
+	}
+	if c.TLSHandshakeTimeout != 0 {
+		inherited.TLSHandshakeTimeout = c.TLSHandshakeTimeout
+	}
+	if c.ResponseHeaderTimeout != 0 {
+		inherited.ResponseHeaderTimeout = c.ResponseHeaderTimeout
+	}
+	if c.IdleConnTimeout != 0 {
+		inherited.IdleConnTimeout = c.IdleConnTimeout
+	}
+	if c.MaxIdleConns != 0 {
+		inherited.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost != 0 {
+		inherited.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	if c.MaxConnsPerHost != 0 {
+		inherited.MaxConnsPerHost = c.MaxConnsPerHost
+	}
+	if c.ProxyUrl != "" {
+		inherited.ProxyUrl = c.ProxyUrl
+	}
+	if c.DisableProxy {
+		inherited.DisableProxy = true
+	}
+	if len(c.RootCAs) > 0 {
+		inherited.RootCAs = c.RootCAs
+	}
+	if len(c.ClientCertificate) > 0 {
+		inherited.ClientCertificate = c.ClientCertificate
+		inherited.ClientKey = c.ClientKey
+	}
+	if c.InsecureSkipVerify {
+		inherited.InsecureSkipVerify = true
+	}
+	return inherited
+}
+
+func newTransport(cfg TransportConfig) (*http.Transport, error) {
+	proxy := http.ProxyFromEnvironment
+	if cfg.DisableProxy {
+		proxy = nil
+	} else if cfg.ProxyUrl != "" {
+		proxyUrl, err := url.Parse(cfg.ProxyUrl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse proxy url: %w", err)
+		}
+		proxy = http.ProxyURL(proxyUrl)
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+	}, nil
+}
+
+func newTLSConfig(cfg TransportConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if len(cfg.RootCAs) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, cert := range cfg.RootCAs {
+			if !pool.AppendCertsFromPEM(cert) {
+				return nil, fmt.Errorf("failed to parse root CA certificate")
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(cfg.ClientCertificate) > 0 {
+		cert, err := tls.X509KeyPair(cfg.ClientCertificate, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,172 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type transportConfigProvider TransportConfig
+
+func (p transportConfigProvider) GetHttpClientConfig() TransportConfig {
+	return TransportConfig(p)
+}
+
+func TestTransportConfigInherit(t *testing.T) {
+	parent := TransportConfig{
+		Timeout:             time.Second,
+		MaxIdleConnsPerHost: 10,
+		ProxyUrl:            "http://proxy:8080",
+		Hosts:               map[string]TransportConfig{"a": {}},
+	}
+
+	tests := []struct {
+		name     string
+		override TransportConfig
+		expected TransportConfig
+	}{
+		{
+			name:     "Inherit zero fields",
+			expected: TransportConfig{Timeout: time.Second, MaxIdleConnsPerHost: 10, ProxyUrl: "http://proxy:8080"},
+		},
+		{
+			name:     "Override set fields",
+			override: TransportConfig{Timeout: 5 * time.Second, DisableProxy: true},
+			expected: TransportConfig{Timeout: 5 * time.Second, MaxIdleConnsPerHost: 10, ProxyUrl: "http://proxy:8080", DisableProxy: true},
+		},
+		{
+			name:     "Ignore nested hosts",
+			override: TransportConfig{Hosts: map[string]TransportConfig{"b": {}}},
+			expected: TransportConfig{Timeout: time.Second, MaxIdleConnsPerHost: 10, ProxyUrl: "http://proxy:8080"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.override.inherit(parent)
+			if got.Timeout != tt.expected.Timeout ||
+				got.MaxIdleConnsPerHost != tt.expected.MaxIdleConnsPerHost ||
+				got.ProxyUrl != tt.expected.ProxyUrl ||
+				got.DisableProxy != tt.expected.DisableProxy ||
+				got.Hosts != nil {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewHostTransport(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         TransportConfig
+		expectError bool
+	}{
+		{
+			name: "Build default config",
+			cfg:  DefaultTransportConfig(),
+		},
+		{
+			name:        "Reject invalid proxy url",
+			cfg:         TransportConfig{ProxyUrl: "http://[::1"},
+			expectError: true,
+		},
+		{
+			name:        "Reject invalid root CA",
+			cfg:         TransportConfig{RootCAs: [][]byte{[]byte("not a certificate")}},
+			expectError: true,
+		},
+		{
+			name:        "Reject invalid client certificate of host",
+			cfg:         TransportConfig{Hosts: map[string]TransportConfig{"example.com": {ClientCertificate: []byte("invalid"), ClientKey: []byte("invalid")}}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewHostTransport(transportConfigProvider(tt.cfg))
+			if (err != nil) != tt.expectError {
+				t.Errorf("expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestHostTransportTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		if r.URL.Path == "/slow-body" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte("done"))
+	}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL)
+
+	tests := []struct {
+		name        string
+		cfg         TransportConfig
+		path        string
+		expectError bool
+	}{
+		{
+			name: "Read body within timeout",
+			cfg:  TransportConfig{Timeout: time.Second},
+			path: "/slow-body",
+		},
+		{
+			name:        "Time out while reading body",
+			cfg:         TransportConfig{Timeout: 20 * time.Millisecond},
+			path:        "/slow-body",
+			expectError: true,
+		},
+		{
+			name: "Use timeout of host override",
+			cfg: TransportConfig{
+				Timeout: time.Second,
+				Hosts:   map[string]TransportConfig{serverUrl.Host: {Timeout: 20 * time.Millisecond}},
+			},
+			path:        "/slow-body",
+			expectError: true,
+		},
+		{
+			name: "Match host override without port",
+			cfg: TransportConfig{
+				Timeout: time.Second,
+				Hosts:   map[string]TransportConfig{serverUrl.Hostname(): {Timeout: 20 * time.Millisecond}},
+			},
+			path:        "/slow-body",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, err := NewHostTransport(transportConfigProvider(tt.cfg))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer transport.CloseIdleConnections()
+
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+tt.path, nil)
+			resp, err := transport.RoundTrip(req)
+			if err == nil {
+				_, err = io.ReadAll(resp.Body)
+				_ = resp.Body.Close()
+			}
+
+			if (err != nil) != tt.expectError {
+				t.Errorf("expected error %v, got %v", tt.expectError, err)
+			}
+			if tt.expectError && !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected context.DeadlineExceeded, got %v", err)
+			}
+		})
+	}
+}
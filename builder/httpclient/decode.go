@@ -0,0 +1,44 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/raythx98/gohelpme/builder/httprequest"
+)
+
+// DecodeResponse reads and closes the response body, decoding it into v with the httprequest.Codec of its `Content-Type`.
+//
+// Responses without a `Content-Type` are decoded as JSON, and an empty body leaves v untouched.
+// An httprequest.ErrNoCodec is returned if no httprequest.Codec is registered for the `Content-Type`.
+func DecodeResponse(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	return decodeBody(resp.Header, body, v)
+}
+
+// decodeBody decodes body into v with the httprequest.Codec of the `Content-Type` in header.
+func decodeBody(header http.Header, body []byte, v any) error {
+	if len(body) == 0 {
+		return nil
+	}
+
+	contentType := header.Get(string(httprequest.ContentTypeKey))
+	if contentType == "" {
+		contentType = string(httprequest.ApplicationJson)
+	}
+
+	codec, ok := httprequest.GetCodec(contentType)
+	if !ok {
+		return fmt.Errorf("failed to decode response body: %w: %s", httprequest.ErrNoCodec, contentType)
+	}
+	if err := codec.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to decode response body: %w", err)
+	}
+	return nil
+}
@@ -5,7 +5,16 @@ import (
 )
 
 // Example is an example of a custom RoundTripper that can be used with the http.Client.
-type Example struct{}
+//
+// It can be added to a Client as a Middleware:
+//
+//	httpclient.NewWithOptions(httpclient.WithMiddlewares(func(next http.RoundTripper) http.RoundTripper {
+//		return &httpclient.Example{Next: next}
+//	}))
+type Example struct {
+	// Next is the RoundTripper that sends the request, defaults to http.DefaultTransport.
+	Next http.RoundTripper
+}
 
 // RoundTrip is a method that satisfies the http.RoundTripper interface.
 // It is called by the http.Client to execute a single HTTP transaction.
@@ -13,7 +22,12 @@ type Example struct{}
 func (t *Example) RoundTrip(req *http.Request) (*http.Response, error) {
 	// Do work before the request is sent
 
-	resp, err := http.DefaultTransport.RoundTrip(req)
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	resp, err := next.RoundTrip(req)
 	if err != nil {
 		return resp, err
 	}
@@ -0,0 +1,182 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInjectedFault wraps every error injected by the FaultInjectionRoundTripper.
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultRule describes a fault injected into matching requests.
+type FaultRule struct {
+	// Host, Method and PathPrefix match the request, empty values match any request.
+	Host       string
+	Method     string
+	PathPrefix string
+	// Probability is the chance of injecting the fault into a matching request, between 0 and 1.
+	Probability float64
+
+	// Latency delays the request before it is sent or the fault is returned.
+	Latency time.Duration
+	// Error is returned instead of sending the request, e.g. syscall.ECONNRESET.
+	Error error
+	// StatusCode and Body are returned instead of sending the request.
+	StatusCode int
+	Body       string
+	// TruncateBody ends the response body with io.ErrUnexpectedEOF after TruncateBodyAfter bytes.
+	TruncateBody      bool
+	TruncateBodyAfter int
+}
+
+// FaultInjector holds the fault rules, which can be changed and toggled at runtime, e.g. from a debug endpoint.
+type FaultInjector struct {
+	enabled atomic.Bool
+	rules   atomic.Pointer[[]FaultRule]
+}
+
+// NewFaultInjector creates a new enabled FaultInjector with the given rules.
+func NewFaultInjector(rules ...FaultRule) *FaultInjector {
+	injector := &FaultInjector{}
+	injector.SetRules(rules...)
+	injector.Enable()
+	return injector
+}
+
+// Enable starts injecting faults.
+func (f *FaultInjector) Enable() {
+	f.enabled.Store(true)
+}
+
+// Disable stops injecting faults, letting every request through.
+func (f *FaultInjector) Disable() {
+	f.enabled.Store(false)
+}
+
+// Enabled reports whether faults are being injected.
+func (f *FaultInjector) Enabled() bool {
+	return f.enabled.Load()
+}
+
+// SetRules replaces the fault rules, the first matching rule that fires is applied.
+func (f *FaultInjector) SetRules(rules ...FaultRule) {
+	f.rules.Store(&rules)
+}
+
+// pick returns the rule to apply to the request, if any.
+func (f *FaultInjector) pick(req *http.Request) (FaultRule, bool) {
+	rules := f.rules.Load()
+	if !f.Enabled() || rules == nil {
+		return FaultRule{}, false
+	}
+
+	for _, rule := range *rules {
+		if rule.matches(req) && rand.Float64() < rule.Probability {
+			return rule, true
+		}
+	}
+	return FaultRule{}, false
+}
+
+func (r *FaultRule) matches(req *http.Request) bool {
+	return (r.Host == "" || strings.EqualFold(r.Host, req.URL.Host) || strings.EqualFold(r.Host, req.URL.Hostname())) &&
+		(r.Method == "" || strings.EqualFold(r.Method, req.Method)) &&
+		strings.HasPrefix(req.URL.Path, r.PathPrefix)
+}
+
+// FaultInjectionRoundTripper is an http.RoundTripper that injects faults into requests,
+// to exercise retry and error handling paths without touching real downstreams.
+type FaultInjectionRoundTripper struct {
+	injector *FaultInjector
+	next     http.RoundTripper
+}
+
+// NewFaultInjectionRoundTripper creates a new FaultInjectionRoundTripper that sends requests through next.
+//
+// If next is nil, http.DefaultTransport is used.
+func NewFaultInjectionRoundTripper(injector *FaultInjector, next http.RoundTripper) *FaultInjectionRoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &FaultInjectionRoundTripper{injector: injector, next: next}
+}
+
+// FaultInjection is a Middleware that injects the faults of injector into requests sent through the next http.RoundTripper.
+//
+// Example:
+//
+//	injector := httpclient.NewFaultInjector(httpclient.FaultRule{Host: "api.partner.com", Probability: 0.2, StatusCode: 503})
+//	client := httpclient.NewWithOptions(httpclient.WithMiddlewares(
+//		httpclient.Retry(httpclient.DefaultRetryConfig()),
+//		httpclient.FaultInjection(injector),
+//	))
+func FaultInjection(injector *FaultInjector) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewFaultInjectionRoundTripper(injector, next)
+	}
+}
+
+// RoundTrip executes a single HTTP transaction, injecting the fault of the first matching rule that fires.
+func (t *FaultInjectionRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rule, ok := t.injector.pick(req)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	if rule.Latency > 0 {
+		if err := sleep(req.Context(), rule.Latency); err != nil {
+			return nil, err
+		}
+	}
+
+	if rule.Error != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInjectedFault, rule.Error)
+	}
+
+	if rule.StatusCode != 0 {
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", rule.StatusCode, http.StatusText(rule.StatusCode)),
+			StatusCode:    rule.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{},
+			Body:          io.NopCloser(strings.NewReader(rule.Body)),
+			ContentLength: int64(len(rule.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || !rule.TruncateBody {
+		return resp, err
+	}
+
+	resp.Body = &truncatedBody{ReadCloser: resp.Body, remaining: rule.TruncateBodyAfter}
+	return resp, nil
+}
+
+// truncatedBody fails with io.ErrUnexpectedEOF after reading the remaining bytes.
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, fmt.Errorf("%w: %w", ErrInjectedFault, io.ErrUnexpectedEOF)
+	}
+	if len(p) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= n
+	return n, err
+}
@@ -0,0 +1,154 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFaultInjectionRoundTripper(t *testing.T) {
+	tests := []struct {
+		name              string
+		injector          func() *FaultInjector
+		method            string
+		url               string
+		expectedErr       error
+		expectedStatus    int
+		expectedBody      string
+		expectedBodyErr   error
+		expectedNextCalls int
+	}{
+		{
+			name: "Inject status and body",
+			injector: func() *FaultInjector {
+				return NewFaultInjector(FaultRule{Probability: 1, Latency: 10 * time.Millisecond, StatusCode: http.StatusServiceUnavailable, Body: "down"})
+			},
+			method:         http.MethodGet,
+			url:            "http://a.com/users",
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "down",
+		},
+		{
+			name: "Inject error",
+			injector: func() *FaultInjector {
+				return NewFaultInjector(FaultRule{Probability: 1, Error: syscall.ECONNRESET})
+			},
+			method:      http.MethodGet,
+			url:         "http://a.com/users",
+			expectedErr: syscall.ECONNRESET,
+		},
+		{
+			name: "Truncate response body",
+			injector: func() *FaultInjector {
+				return NewFaultInjector(FaultRule{Probability: 1, TruncateBody: true, TruncateBodyAfter: 3})
+			},
+			method:            http.MethodGet,
+			url:               "http://a.com/users",
+			expectedStatus:    http.StatusOK,
+			expectedBody:      "pay",
+			expectedBodyErr:   io.ErrUnexpectedEOF,
+			expectedNextCalls: 1,
+		},
+		{
+			name: "Apply first matching rule",
+			injector: func() *FaultInjector {
+				return NewFaultInjector(
+					FaultRule{Host: "b.com", Probability: 1, StatusCode: http.StatusBadGateway},
+					FaultRule{Method: http.MethodPost, Probability: 1, StatusCode: http.StatusBadGateway},
+					FaultRule{PathPrefix: "/orders", Probability: 1, StatusCode: http.StatusBadGateway},
+					FaultRule{Host: "a.com", PathPrefix: "/users", Probability: 1, StatusCode: http.StatusTooManyRequests},
+				)
+			},
+			method:         http.MethodGet,
+			url:            "http://a.com:8080/users/1",
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			name: "Let request through without matching rule",
+			injector: func() *FaultInjector {
+				return NewFaultInjector(FaultRule{Host: "b.com", Probability: 1, StatusCode: http.StatusBadGateway})
+			},
+			method:            http.MethodGet,
+			url:               "http://a.com/users",
+			expectedStatus:    http.StatusOK,
+			expectedBody:      "payload",
+			expectedNextCalls: 1,
+		},
+		{
+			name: "Let request through with zero probability",
+			injector: func() *FaultInjector {
+				return NewFaultInjector(FaultRule{StatusCode: http.StatusBadGateway})
+			},
+			method:            http.MethodGet,
+			url:               "http://a.com/users",
+			expectedStatus:    http.StatusOK,
+			expectedBody:      "payload",
+			expectedNextCalls: 1,
+		},
+		{
+			name: "Let request through when disabled",
+			injector: func() *FaultInjector {
+				injector := NewFaultInjector(FaultRule{Probability: 1, StatusCode: http.StatusBadGateway})
+				injector.Disable()
+				return injector
+			},
+			method:            http.MethodGet,
+			url:               "http://a.com/users",
+			expectedStatus:    http.StatusOK,
+			expectedBody:      "payload",
+			expectedNextCalls: 1,
+		},
+		{
+			name: "Let request through when no rules were set",
+			injector: func() *FaultInjector {
+				injector := &FaultInjector{}
+				injector.Enable()
+				return injector
+			},
+			method:            http.MethodGet,
+			url:               "http://a.com/users",
+			expectedStatus:    http.StatusOK,
+			expectedBody:      "payload",
+			expectedNextCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nextCalls int
+			next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				nextCalls++
+				return newResponse(req, http.StatusOK, "payload"), nil
+			})
+
+			resp, err := NewFaultInjectionRoundTripper(tt.injector(), next).RoundTrip(httptest.NewRequest(tt.method, tt.url, nil))
+			if nextCalls != tt.expectedNextCalls {
+				t.Errorf("expected %d requests sent, got %d", tt.expectedNextCalls, nextCalls)
+			}
+			if tt.expectedErr != nil {
+				if !errors.Is(err, ErrInjectedFault) || !errors.Is(err, tt.expectedErr) {
+					t.Errorf("expected injected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if string(body) != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, string(body))
+			}
+			if !errors.Is(err, tt.expectedBodyErr) {
+				t.Errorf("expected body error %v, got %v", tt.expectedBodyErr, err)
+			}
+		})
+	}
+}
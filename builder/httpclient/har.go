@@ -0,0 +1,461 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/raythx98/gohelpme/tool/httphelper"
+	"github.com/raythx98/gohelpme/tool/redactor"
+)
+
+// HarArchive is an HTTP Archive document, as defined by the HAR 1.2 specification.
+type HarArchive struct {
+	Log HarLog `json:"log"`
+}
+
+// HarLog is the root of a HarArchive.
+type HarLog struct {
+	Version string      `json:"version"`
+	Creator HarCreator  `json:"creator"`
+	Entries []*HarEntry `json:"entries"`
+}
+
+// HarCreator is the application that created a HarArchive.
+type HarCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HarEntry is a request and response pair of a HarArchive.
+type HarEntry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	// Time is the total duration of the request in milliseconds.
+	Time     float64     `json:"time"`
+	Request  HarRequest  `json:"request"`
+	Response HarResponse `json:"response"`
+	Cache    struct{}    `json:"cache"`
+	Timings  HarTimings  `json:"timings"`
+	// Comment holds the error of requests that failed without a response.
+	Comment string `json:"comment,omitempty"`
+}
+
+// HarRequest is the request of a HarEntry.
+type HarRequest struct {
+	Method      string         `json:"method"`
+	Url         string         `json:"url"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []HarNameValue `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	QueryString []HarNameValue `json:"queryString"`
+	PostData    *HarPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HarResponse is the response of a HarEntry, with a zero Status if the request failed.
+type HarResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []HarNameValue `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	Content     HarContent     `json:"content"`
+	RedirectUrl string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HarNameValue is a header, query parameter or cookie.
+type HarNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HarPostData is the request body of a HarRequest.
+type HarPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HarContent is the response body of a HarResponse.
+type HarContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	// Encoding is "base64" when Text is base64 encoded, as it is not valid UTF-8.
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HarTimings are the durations of the phases of a request in milliseconds, -1 if they do not apply.
+type HarTimings struct {
+	Blocked float64 `json:"blocked"`
+	Dns     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	Ssl     float64 `json:"ssl"`
+}
+
+// HarConfig is the configuration for the HarRecorder.
+type HarConfig struct {
+	// RedactedPaths are redacted before entries are recorded, same as LogConfig,
+	// e.g. "request.headers.authorization" or "response.body.access_token".
+	RedactedPaths []string
+	// MaxBodyBytes truncates the recorded request and response bodies, 0 records bodies in full.
+	//
+	// A truncated body cannot be parsed for redaction, so it is redacted entirely if any of its paths are redacted.
+	MaxBodyBytes int64
+	// MaxEntries keeps only the most recent entries, 0 keeps every entry.
+	MaxEntries int
+}
+
+// DefaultHarConfig returns a HarConfig that redacts credentials, and keeps the last 1000 entries with bodies up to 64KiB.
+func DefaultHarConfig() HarConfig {
+	return HarConfig{
+		RedactedPaths: []string{
+			"request.headers.authorization",
+			"request.headers.proxy-authorization",
+			"request.headers.cookie",
+			"response.headers.set-cookie",
+		},
+		MaxBodyBytes: 64 << 10,
+		MaxEntries:   1000,
+	}
+}
+
+// HarRecorder accumulates the entries recorded by HarRoundTrippers into a HarArchive,
+// which can be written to a file or served from a debug endpoint:
+//
+//	recorder := httpclient.NewHarRecorder(httpclient.DefaultHarConfig())
+//	client := httpclient.NewWithOptions(httpclient.WithMiddlewares(httpclient.Har(recorder)))
+//	mux.Handle("GET /debug/har", recorder)
+type HarRecorder struct {
+	cfg HarConfig
+
+	mu      sync.Mutex
+	entries []*HarEntry
+}
+
+// NewHarRecorder creates a new HarRecorder.
+func NewHarRecorder(cfg HarConfig) *HarRecorder {
+	return &HarRecorder{cfg: cfg}
+}
+
+// Archive returns a HarArchive of the recorded entries.
+func (r *HarRecorder) Archive() *HarArchive {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &HarArchive{
+		Log: HarLog{
+			Version: "1.2",
+			Creator: HarCreator{Name: "gohelpme", Version: "1.0"},
+			Entries: slices.Clone(r.entries),
+		},
+	}
+}
+
+// Reset discards the recorded entries.
+func (r *HarRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = nil
+}
+
+// WriteFile writes the HarArchive of the recorded entries to path.
+func (r *HarRecorder) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r.Archive(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode har: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to write har: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write har: %w", err)
+	}
+	return nil
+}
+
+// ServeHTTP serves the HarArchive of the recorded entries as a download.
+func (r *HarRecorder) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="outbound.har"`)
+	_ = json.NewEncoder(w).Encode(r.Archive())
+}
+
+func (r *HarRecorder) add(entry *HarEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = append(r.entries, entry)
+	if r.cfg.MaxEntries > 0 && len(r.entries) > r.cfg.MaxEntries {
+		r.entries = slices.Delete(r.entries, 0, len(r.entries)-r.cfg.MaxEntries)
+	}
+}
+
+// HarRoundTripper is an http.RoundTripper that records requests and responses into a HarRecorder.
+type HarRoundTripper struct {
+	recorder *HarRecorder
+	next     http.RoundTripper
+}
+
+// NewHarRoundTripper creates a new HarRoundTripper that sends requests through next.
+//
+// If next is nil, http.DefaultTransport is used.
+func NewHarRoundTripper(recorder *HarRecorder, next http.RoundTripper) *HarRoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &HarRoundTripper{recorder: recorder, next: next}
+}
+
+// Har is a Middleware that records requests and responses sent through the next http.RoundTripper into recorder.
+//
+// Like the LogRoundTripper, body capture is disabled for requests sent with WithoutBodyLog.
+func Har(recorder *HarRecorder) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewHarRoundTripper(recorder, next)
+	}
+}
+
+// harCapture holds the parts of a request and response that are redacted before being recorded.
+type harCapture struct {
+	Request  harCaptured `json:"request"`
+	Response harCaptured `json:"response"`
+}
+
+type harCaptured struct {
+	Headers   http.Header `json:"headers"`
+	Body      string      `json:"body"`
+	Truncated bool        `json:"body truncated"`
+}
+
+// RoundTrip executes a single HTTP transaction, recording its timings, headers and bodies.
+func (t *HarRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	startAt := time.Now()
+	timer := &harTimer{}
+	tracedReq := req.WithContext(httptrace.WithClientTrace(req.Context(), timer.trace()))
+
+	skipBody, _ := req.Context().Value(skipBodyLogKey{}).(bool)
+
+	logs := map[string]interface{}{}
+	logs["request"] = t.capture(tracedReq.Header, skipBody, func() (string, bool) {
+		return httphelper.PeekRequestBody(tracedReq, t.recorder.cfg.MaxBodyBytes)
+	})
+
+	resp, err := t.next.RoundTrip(tracedReq)
+
+	if resp != nil {
+		logs["response"] = t.capture(resp.Header, skipBody, func() (string, bool) {
+			return httphelper.PeekResponseBody(resp, t.recorder.cfg.MaxBodyBytes)
+		})
+	}
+	endAt := time.Now()
+
+	var captured harCapture
+	data, _ := json.Marshal(redactLogs(logs, t.recorder.cfg.RedactedPaths))
+	_ = json.Unmarshal(data, &captured)
+	restoreBinaryBody(&captured.Request, logs["request"])
+	restoreBinaryBody(&captured.Response, logs["response"])
+
+	entry := &HarEntry{
+		StartedDateTime: startAt,
+		Time:            milliseconds(endAt.Sub(startAt)),
+		Request:         newHarRequest(req, &captured.Request),
+		Timings:         timer.timings(startAt, endAt),
+	}
+	if err != nil {
+		entry.Comment = err.Error()
+	}
+	if resp != nil {
+		entry.Request.HttpVersion = resp.Proto
+		entry.Response = newHarResponse(resp, &captured.Response)
+	}
+	t.recorder.add(entry)
+
+	return resp, err
+}
+
+func (t *HarRoundTripper) capture(headers http.Header, skipBody bool, peek func() (string, bool)) map[string]interface{} {
+	group := map[string]interface{}{"headers": headers}
+	if !skipBody {
+		body, truncated := peek()
+		group["body"] = body
+		if truncated {
+			group["body truncated"] = true
+		}
+	}
+	return group
+}
+
+// restoreBinaryBody restores a body that is not valid UTF-8, which the JSON encoding for redaction replaces,
+// unless it was redacted entirely.
+func restoreBinaryBody(captured *harCaptured, group interface{}) {
+	logGroup, _ := group.(map[string]interface{})
+	body, _ := logGroup["body"].(string)
+	if !utf8.ValidString(body) && captured.Body != redactor.RedactedValue {
+		captured.Body = body
+	}
+}
+
+func newHarRequest(req *http.Request, captured *harCaptured) HarRequest {
+	harReq := HarRequest{
+		Method:      req.Method,
+		Url:         req.URL.String(),
+		HttpVersion: "HTTP/1.1",
+		Cookies:     []HarNameValue{},
+		Headers:     harNameValues(captured.Headers),
+		QueryString: harNameValues(req.URL.Query()),
+		HeadersSize: -1,
+		BodySize:    req.ContentLength,
+	}
+
+	if captured.Body != "" {
+		harReq.PostData = &HarPostData{MimeType: req.Header.Get("Content-Type"), Text: captured.Body}
+		if !utf8.ValidString(captured.Body) {
+			harReq.PostData.Text = ""
+			harReq.PostData.Comment = "binary body omitted"
+		}
+		if captured.Truncated {
+			harReq.PostData.Comment = "body truncated"
+		}
+	}
+	return harReq
+}
+
+func newHarResponse(resp *http.Response, captured *harCaptured) HarResponse {
+	bodySize := resp.ContentLength
+	if bodySize < 0 && !captured.Truncated && captured.Body != "" {
+		bodySize = int64(len(captured.Body))
+	}
+
+	harResp := HarResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HttpVersion: resp.Proto,
+		Cookies:     []HarNameValue{},
+		Headers:     harNameValues(captured.Headers),
+		Content: HarContent{
+			Size:     bodySize,
+			MimeType: resp.Header.Get("Content-Type"),
+		},
+		RedirectUrl: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    bodySize,
+	}
+
+	var isBase64 bool
+	harResp.Content.Text, isBase64 = encodeBody(captured.Body)
+	if isBase64 {
+		harResp.Content.Encoding = "base64"
+	}
+	if captured.Truncated {
+		harResp.Content.Comment = "body truncated"
+	}
+	return harResp
+}
+
+// harNameValues flattens headers or query parameters into name-value pairs sorted by name.
+func harNameValues(values map[string][]string) []HarNameValue {
+	pairs := []HarNameValue{}
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		for _, value := range values[name] {
+			pairs = append(pairs, HarNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+// harTimer records the phases of a request through an httptrace.ClientTrace.
+type harTimer struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+func (h *harTimer) trace() *httptrace.ClientTrace {
+	// A connection may be dialed more than once, so the first start and the last completion are kept
+	first := func(at *time.Time) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if at.IsZero() {
+			*at = time.Now()
+		}
+	}
+	last := func(at *time.Time) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		*at = time.Now()
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { first(&h.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { last(&h.dnsDone) },
+		ConnectStart:         func(string, string) { first(&h.connectStart) },
+		ConnectDone:          func(string, string, error) { last(&h.connectDone) },
+		TLSHandshakeStart:    func() { first(&h.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { last(&h.tlsDone) },
+		GotConn:              func(httptrace.GotConnInfo) { first(&h.gotConn) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { last(&h.wroteRequest) },
+		GotFirstResponseByte: func() { first(&h.firstByte) },
+	}
+}
+
+// timings returns the HarTimings of a request sent at startAt whose response was read at endAt.
+func (h *harTimer) timings(startAt, endAt time.Time) HarTimings {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	timings := HarTimings{
+		Dns:     span(h.dnsStart, h.dnsDone),
+		Connect: span(h.connectStart, h.connectDone),
+		Ssl:     span(h.tlsStart, h.tlsDone),
+		Blocked: -1,
+	}
+	// The connect time includes the TLS handshake
+	if timings.Ssl > 0 && timings.Connect >= 0 {
+		timings.Connect += timings.Ssl
+	}
+
+	if !h.gotConn.IsZero() {
+		timings.Blocked = max(milliseconds(h.gotConn.Sub(startAt))-max(timings.Dns, 0)-max(timings.Connect, 0), 0)
+		timings.Send = max(span(h.gotConn, h.wroteRequest), 0)
+	}
+	timings.Wait = max(span(h.wroteRequest, h.firstByte), 0)
+	timings.Receive = max(span(h.firstByte, endAt), 0)
+	return timings
+}
+
+// span returns the duration between start and end in milliseconds, or -1 if either is unknown.
+func span(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() {
+		return -1
+	}
+	return milliseconds(end.Sub(start))
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,173 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHarRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Set-Cookie", "session=secret-cookie")
+			_, _ = w.Write([]byte(`{"access_token":"secret-token","name":"alice"}`))
+		case "/binary":
+			_, _ = w.Write([]byte{0xff, 0xfe})
+		default:
+			_, _ = w.Write([]byte("hello world"))
+		}
+	}))
+	defer server.Close()
+
+	redactToken := DefaultHarConfig()
+	redactToken.RedactedPaths = append(redactToken.RedactedPaths, "response.body.access_token")
+
+	tests := []struct {
+		name                    string
+		cfg                     HarConfig
+		skipBody                bool
+		path                    string
+		body                    string
+		expectedPostData        *HarPostData
+		expectedContentText     string
+		expectedContentEncoding string
+		expectedContentComment  string
+	}{
+		{
+			name:                "Record request and response with redaction",
+			cfg:                 redactToken,
+			path:                "/token?grant=password",
+			body:                `{"user":"alice"}`,
+			expectedPostData:    &HarPostData{MimeType: "application/json", Text: `{"user":"alice"}`},
+			expectedContentText: `{"access_token":"*REDACTED*","name":"alice"}`,
+		},
+		{
+			name:                   "Truncate bodies over MaxBodyBytes",
+			cfg:                    HarConfig{RedactedPaths: DefaultHarConfig().RedactedPaths, MaxBodyBytes: 5},
+			path:                   "/",
+			body:                   `{"user":"alice"}`,
+			expectedPostData:       &HarPostData{MimeType: "application/json", Text: `{"use`, Comment: "body truncated"},
+			expectedContentText:    "hello",
+			expectedContentComment: "body truncated",
+		},
+		{
+			name:                    "Encode binary response body in base64",
+			cfg:                     DefaultHarConfig(),
+			path:                    "/binary",
+			expectedContentText:     "//4=",
+			expectedContentEncoding: "base64",
+		},
+		{
+			name:     "Skip bodies of requests sent without body log",
+			cfg:      DefaultHarConfig(),
+			skipBody: true,
+			path:     "/token",
+			body:     `{"user":"alice"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := NewHarRecorder(tt.cfg)
+			client := &http.Client{Transport: NewHarRoundTripper(recorder, nil)}
+
+			ctx := context.Background()
+			if tt.skipBody {
+				ctx = WithoutBodyLog(ctx)
+			}
+			req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer secret-token")
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_ = resp.Body.Close()
+
+			entries := recorder.Archive().Log.Entries
+			if len(entries) != 1 {
+				t.Fatalf("expected 1 entry, got %d", len(entries))
+			}
+			entry := entries[0]
+
+			if entry.Request.Method != http.MethodPost || entry.Request.Url != server.URL+tt.path {
+				t.Errorf("expected request POST %s, got %s %s", server.URL+tt.path, entry.Request.Method, entry.Request.Url)
+			}
+			if entry.Response.Status != http.StatusOK || entry.Response.HttpVersion != "HTTP/1.1" {
+				t.Errorf("expected response HTTP/1.1 200, got %s %d", entry.Response.HttpVersion, entry.Response.Status)
+			}
+			if !slices.Contains(entry.Request.Headers, HarNameValue{Name: "Authorization", Value: "*REDACTED*"}) {
+				t.Errorf("expected redacted Authorization header, got %v", entry.Request.Headers)
+			}
+			if (entry.Request.PostData == nil) != (tt.expectedPostData == nil) ||
+				tt.expectedPostData != nil && *entry.Request.PostData != *tt.expectedPostData {
+				t.Errorf("expected post data %+v, got %+v", tt.expectedPostData, entry.Request.PostData)
+			}
+			if content := entry.Response.Content; content.Text != tt.expectedContentText ||
+				content.Encoding != tt.expectedContentEncoding ||
+				content.Comment != tt.expectedContentComment {
+				t.Errorf("expected content %q %q %q, got %q %q %q",
+					tt.expectedContentText, tt.expectedContentEncoding, tt.expectedContentComment,
+					content.Text, content.Encoding, content.Comment)
+			}
+			if entry.Timings.Wait < 0 || entry.Timings.Receive < 0 || entry.Time <= 0 {
+				t.Errorf("expected timings to be recorded, got %+v in %vms", entry.Timings, entry.Time)
+			}
+
+			data, _ := json.Marshal(entry)
+			for _, secret := range []string{"secret-token", "secret-cookie"} {
+				if strings.Contains(string(data), secret) {
+					t.Errorf("expected %s to be redacted, got %s", secret, string(data))
+				}
+			}
+		})
+	}
+}
+
+func TestHarRecorder(t *testing.T) {
+	next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return newResponse(req, http.StatusOK, ""), nil
+	})
+	recorder := NewHarRecorder(HarConfig{MaxEntries: 2})
+	transport := NewHarRoundTripper(recorder, next)
+	for _, path := range []string{"/a", "/b", "/c"} {
+		if _, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "http://example.com"+path, nil)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	harPath := filepath.Join(t.TempDir(), "outbound.har")
+	if err := recorder.WriteFile(harPath); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := os.ReadFile(harPath)
+	var archive HarArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var urls []string
+	for _, entry := range archive.Log.Entries {
+		urls = append(urls, entry.Request.Url)
+	}
+	if expected := []string{"http://example.com/b", "http://example.com/c"}; !slices.Equal(urls, expected) {
+		t.Errorf("expected most recent entries %v, got %v", expected, urls)
+	}
+	if archive.Log.Version != "1.2" {
+		t.Errorf("expected har version 1.2, got %s", archive.Log.Version)
+	}
+
+	recorder.Reset()
+	if entries := recorder.Archive().Log.Entries; len(entries) != 0 {
+		t.Errorf("expected no entries after reset, got %d", len(entries))
+	}
+}
@@ -0,0 +1,209 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/raythx98/gohelpme/builder/httprequest"
+)
+
+// HedgeConfig is the configuration for the HedgeRoundTripper.
+type HedgeConfig struct {
+	// Delay is how long to wait for a response before sending a hedged request.
+	Delay time.Duration
+	// Percentile replaces Delay with the given percentile of observed latencies, e.g. 0.95, once MinSamples are observed.
+	// Latencies are measured from the original request, so that fast hedged responses do not shorten the delay.
+	Percentile float64
+	// MinSamples is the number of observed latencies required before Percentile is used.
+	MinSamples int
+	// SampleSize is the number of most recent latencies kept to compute Percentile.
+	SampleSize int
+	// MaxHedges is the maximum number of hedged requests sent in addition to the original one.
+	MaxHedges int
+}
+
+// DefaultHedgeConfig returns a HedgeConfig that sends one hedged request after the p95 latency, or 100ms until it is known.
+func DefaultHedgeConfig() HedgeConfig {
+	return HedgeConfig{
+		Delay:      100 * time.Millisecond,
+		Percentile: 0.95,
+		MinSamples: 100,
+		SampleSize: 1000,
+		MaxHedges:  1,
+	}
+}
+
+// HedgeRoundTripper is an http.RoundTripper that reduces tail latency by sending duplicate requests
+// when a response takes too long, returning the first successful response and cancelling the others.
+//
+// Only idempotent methods, as defined by httprequest.Method, are hedged.
+type HedgeRoundTripper struct {
+	cfg  HedgeConfig
+	next http.RoundTripper
+
+	mu          sync.Mutex
+	latencies   []time.Duration
+	nextSample  int
+	sampleCount int
+}
+
+type hedgeResult struct {
+	index  int
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+// NewHedgeRoundTripper creates a new HedgeRoundTripper that sends requests through next.
+//
+// If next is nil, http.DefaultTransport is used.
+func NewHedgeRoundTripper(cfg HedgeConfig, next http.RoundTripper) *HedgeRoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if cfg.SampleSize <= 0 {
+		cfg.SampleSize = 1000
+	}
+	return &HedgeRoundTripper{
+		cfg:       cfg,
+		next:      next,
+		latencies: make([]time.Duration, cfg.SampleSize),
+	}
+}
+
+// Hedge is a Middleware that hedges idempotent requests sent through the next http.RoundTripper.
+func Hedge(cfg HedgeConfig) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewHedgeRoundTripper(cfg, next)
+	}
+}
+
+// RoundTrip executes the HTTP transaction, sending up to MaxHedges duplicates while waiting for a successful response.
+func (t *HedgeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.cfg.MaxHedges <= 0 || !httprequest.Method(req.Method).IsIdempotent() {
+		return t.next.RoundTrip(req)
+	}
+
+	startAt := time.Now()
+	ctx := req.Context()
+	getBody := rewindBody(req)
+	results := make(chan *hedgeResult, t.cfg.MaxHedges+1)
+
+	var cancels []context.CancelFunc
+	send := func() error {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		attemptReq, err := cloneRequest(req.WithContext(attemptCtx), getBody)
+		if err != nil {
+			cancel()
+			return err
+		}
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+
+		go func() {
+			resp, err := t.next.RoundTrip(attemptReq)
+			results <- &hedgeResult{index: index, resp: resp, err: err, cancel: cancel}
+		}()
+		return nil
+	}
+	// cancelOthers cancels every request but the one at index, discarding the pending responses.
+	cancelOthers := func(index int, pending int) {
+		for i, cancel := range cancels {
+			if i != index {
+				cancel()
+			}
+		}
+		go func() {
+			for ; pending > 0; pending-- {
+				drainBody((<-results).resp)
+			}
+		}()
+	}
+
+	if err := send(); err != nil {
+		return nil, err
+	}
+	sent, pending := 1, 1
+
+	delay := t.delay()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var last *hedgeResult
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if sent > t.cfg.MaxHedges {
+				continue
+			}
+			if err := send(); err == nil {
+				sent++
+				pending++
+			}
+			timer.Reset(delay)
+		case result := <-results:
+			pending--
+			if last != nil {
+				drainBody(last.resp)
+				last.cancel()
+			}
+			last = result
+			if result.err == nil && result.resp.StatusCode < http.StatusInternalServerError {
+				t.record(time.Since(startAt))
+				cancelOthers(result.index, pending)
+				return withCancel(result), nil
+			}
+		case <-ctx.Done():
+			cancelOthers(-1, pending)
+			if last != nil {
+				drainBody(last.resp)
+			}
+			return nil, ctx.Err()
+		}
+	}
+
+	// Every request failed, so the last failure is returned as is
+	if last.err != nil {
+		last.cancel()
+		return last.resp, last.err
+	}
+	return withCancel(last), nil
+}
+
+// withCancel ties the context of the request that produced result to its response body.
+func withCancel(result *hedgeResult) *http.Response {
+	result.resp.Body = &cancelOnClose{ReadCloser: result.resp.Body, cancel: result.cancel}
+	return result.resp
+}
+
+// delay returns the configured Percentile of the observed latencies, or Delay if not enough are observed.
+func (t *HedgeRoundTripper) delay() time.Duration {
+	if t.cfg.Percentile <= 0 {
+		return t.cfg.Delay
+	}
+
+	t.mu.Lock()
+	count := min(t.sampleCount, len(t.latencies))
+	if count == 0 || count < t.cfg.MinSamples {
+		t.mu.Unlock()
+		return t.cfg.Delay
+	}
+	samples := slices.Clone(t.latencies[:count])
+	t.mu.Unlock()
+
+	slices.Sort(samples)
+	index := int(t.cfg.Percentile * float64(count-1))
+	return samples[min(max(index, 0), count-1)]
+}
+
+func (t *HedgeRoundTripper) record(latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.latencies[t.nextSample] = latency
+	t.nextSample = (t.nextSample + 1) % len(t.latencies)
+	t.sampleCount++
+}
@@ -0,0 +1,222 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgeRoundTripper(t *testing.T) {
+	type attempt struct {
+		latency time.Duration
+		status  int
+	}
+	fast := attempt{status: http.StatusOK}
+	slow := attempt{latency: time.Second, status: http.StatusOK}
+
+	tests := []struct {
+		name             string
+		cfg              HedgeConfig
+		method           string
+		timeout          time.Duration
+		attempts         []attempt
+		expectedAttempts int32
+		expectedStatus   int
+		expectedBody     string
+		expectedErr      error
+	}{
+		{
+			name:             "Return fast response without hedging",
+			cfg:              HedgeConfig{Delay: 50 * time.Millisecond, MaxHedges: 1},
+			method:           http.MethodPut,
+			attempts:         []attempt{fast},
+			expectedAttempts: 1,
+			expectedStatus:   http.StatusOK,
+			expectedBody:     "0:payload",
+		},
+		{
+			name:             "Return hedged response of slow request",
+			cfg:              HedgeConfig{Delay: 10 * time.Millisecond, MaxHedges: 1},
+			method:           http.MethodPut,
+			attempts:         []attempt{slow, fast},
+			expectedAttempts: 2,
+			expectedStatus:   http.StatusOK,
+			expectedBody:     "1:payload",
+		},
+		{
+			name:             "Send at most MaxHedges hedged requests",
+			cfg:              HedgeConfig{Delay: 10 * time.Millisecond, MaxHedges: 2},
+			method:           http.MethodGet,
+			attempts:         []attempt{slow, slow, {latency: 50 * time.Millisecond, status: http.StatusOK}, fast},
+			expectedAttempts: 3,
+			expectedStatus:   http.StatusOK,
+			expectedBody:     "2:",
+		},
+		{
+			name:             "Do not hedge non-idempotent method",
+			cfg:              HedgeConfig{Delay: 10 * time.Millisecond, MaxHedges: 1},
+			method:           http.MethodPost,
+			attempts:         []attempt{{latency: 50 * time.Millisecond, status: http.StatusOK}, fast},
+			expectedAttempts: 1,
+			expectedStatus:   http.StatusOK,
+			expectedBody:     "0:payload",
+		},
+		{
+			name:   "Return last failure when every request fails",
+			cfg:    HedgeConfig{Delay: 10 * time.Millisecond, MaxHedges: 1},
+			method: http.MethodGet,
+			attempts: []attempt{
+				{latency: 50 * time.Millisecond, status: http.StatusServiceUnavailable},
+				{latency: 50 * time.Millisecond, status: http.StatusBadGateway},
+			},
+			expectedAttempts: 2,
+			expectedStatus:   http.StatusBadGateway,
+			expectedBody:     "1:",
+		},
+		{
+			name:             "Stop hedging when the context is done",
+			cfg:              HedgeConfig{Delay: 10 * time.Millisecond, MaxHedges: 1},
+			method:           http.MethodGet,
+			timeout:          50 * time.Millisecond,
+			attempts:         []attempt{slow, slow},
+			expectedAttempts: 2,
+			expectedErr:      context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				index := int(attempts.Add(1)) - 1
+				a := tt.attempts[min(index, len(tt.attempts)-1)]
+				body, _ := io.ReadAll(req.Body)
+
+				select {
+				case <-time.After(a.latency):
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				}
+				return newResponse(req, a.status, fmt.Sprintf("%d:%s", index, body)), nil
+			})
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			var reqBody io.Reader
+			if tt.method != http.MethodGet {
+				reqBody = strings.NewReader("payload")
+			}
+			req := httptest.NewRequest(tt.method, "http://example.com/users", reqBody).WithContext(ctx)
+
+			resp, err := NewHedgeRoundTripper(tt.cfg, next).RoundTrip(req)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error %v, got %v", tt.expectedErr, err)
+			}
+			if got := attempts.Load(); got != tt.expectedAttempts {
+				t.Errorf("expected %d requests sent, got %d", tt.expectedAttempts, got)
+			}
+			if err != nil {
+				return
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if string(body) != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, string(body))
+			}
+		})
+	}
+}
+
+func TestHedgeRoundTripperDelay(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           HedgeConfig
+		latencies     []time.Duration
+		expectedDelay time.Duration
+	}{
+		{
+			name:          "Use Delay without Percentile",
+			cfg:           HedgeConfig{Delay: time.Second},
+			latencies:     []time.Duration{10 * time.Millisecond, 20 * time.Millisecond},
+			expectedDelay: time.Second,
+		},
+		{
+			name:          "Use Delay until MinSamples are observed",
+			cfg:           HedgeConfig{Delay: time.Second, Percentile: 0.5, MinSamples: 3},
+			latencies:     []time.Duration{10 * time.Millisecond, 20 * time.Millisecond},
+			expectedDelay: time.Second,
+		},
+		{
+			name:          "Use percentile of observed latencies",
+			cfg:           HedgeConfig{Delay: time.Second, Percentile: 0.5, MinSamples: 3},
+			latencies:     []time.Duration{30 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond},
+			expectedDelay: 20 * time.Millisecond,
+		},
+		{
+			name:          "Keep only SampleSize most recent latencies",
+			cfg:           HedgeConfig{Delay: time.Second, Percentile: 0.5, MinSamples: 2, SampleSize: 2},
+			latencies:     []time.Duration{10 * time.Millisecond, 40 * time.Millisecond, 30 * time.Millisecond},
+			expectedDelay: 30 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := NewHedgeRoundTripper(tt.cfg, nil)
+			for _, latency := range tt.latencies {
+				transport.record(latency)
+			}
+			if got := transport.delay(); got != tt.expectedDelay {
+				t.Errorf("expected delay %v, got %v", tt.expectedDelay, got)
+			}
+		})
+	}
+}
+
+func TestHedgeRoundTripperDelayFeedback(t *testing.T) {
+	var attempts atomic.Int32
+	next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		// The original request of every call is slow, so that its hedged request wins
+		if attempts.Add(1)%2 == 1 {
+			select {
+			case <-time.After(time.Second):
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
+		return newResponse(req, http.StatusOK, ""), nil
+	})
+	cfg := HedgeConfig{Delay: 20 * time.Millisecond, Percentile: 0.5, MinSamples: 1, MaxHedges: 1}
+	transport := NewHedgeRoundTripper(cfg, next)
+
+	previous := transport.delay()
+	for i := 0; i < 5; i++ {
+		resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "http://example.com/users", nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+
+		delay := transport.delay()
+		if delay < previous || delay < cfg.Delay {
+			t.Fatalf("expected delay to stay above %v, got %v after %v", max(previous, cfg.Delay), delay, previous)
+		}
+		previous = delay
+	}
+}
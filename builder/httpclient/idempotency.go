@@ -0,0 +1,103 @@
+package httpclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"github.com/raythx98/gohelpme/builder/httprequest"
+	"github.com/raythx98/gohelpme/tool/reqctx"
+)
+
+// IdempotencyConfig is the configuration for the IdempotencyKeyRoundTripper.
+type IdempotencyConfig struct {
+	// Methods are the methods of the requests that get an `Idempotency-Key` header.
+	Methods []httprequest.Method
+	// FromContext derives the key from the idempotency key of the reqctx.Value of the request, if any,
+	// instead of generating one, so that retries of the inbound request send the same outbound keys.
+	//
+	// The key is derived from the inbound key, method and url of the outbound request, so calls to different
+	// endpoints get different keys, but calls with the same method and url share one. Set the key of such calls
+	// with httprequest.Builder.WithIdempotencyKey instead.
+	FromContext bool
+	// Generate generates a new key, defaults to uuid.NewString.
+	Generate func() string
+}
+
+// DefaultIdempotencyConfig returns an IdempotencyConfig that adds keys to POST, PUT, PATCH and DELETE requests,
+// derived from reqctx or generated.
+func DefaultIdempotencyConfig() IdempotencyConfig {
+	return IdempotencyConfig{
+		Methods:     []httprequest.Method{httprequest.Post, httprequest.Put, httprequest.Patch, httprequest.Delete},
+		FromContext: true,
+		Generate:    uuid.NewString,
+	}
+}
+
+// IdempotencyKeyRoundTripper is an http.RoundTripper that adds an `Idempotency-Key` header to mutations,
+// so that downstream services can safely deduplicate them.
+//
+// Requests that already have the header keep it.
+type IdempotencyKeyRoundTripper struct {
+	cfg  IdempotencyConfig
+	next http.RoundTripper
+}
+
+// NewIdempotencyKeyRoundTripper creates a new IdempotencyKeyRoundTripper that sends requests through next.
+//
+// If next is nil, http.DefaultTransport is used.
+func NewIdempotencyKeyRoundTripper(cfg IdempotencyConfig, next http.RoundTripper) *IdempotencyKeyRoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if cfg.Generate == nil {
+		cfg.Generate = uuid.NewString
+	}
+	return &IdempotencyKeyRoundTripper{cfg: cfg, next: next}
+}
+
+// IdempotencyKey is a Middleware that adds an `Idempotency-Key` header to mutations sent through the next http.RoundTripper.
+//
+// It must be listed before Retry, so that every attempt is sent with the same key, and before Log to log the key:
+//
+//	client := httpclient.NewWithOptions(httpclient.WithMiddlewares(
+//		httpclient.IdempotencyKey(httpclient.DefaultIdempotencyConfig()),
+//		httpclient.Log(log, httpclient.DefaultLogConfig()),
+//		httpclient.Retry(httpclient.DefaultRetryConfig()),
+//	))
+func IdempotencyKey(cfg IdempotencyConfig) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewIdempotencyKeyRoundTripper(cfg, next)
+	}
+}
+
+// RoundTrip executes a single HTTP transaction, adding an `Idempotency-Key` header if the request is a mutation without one.
+func (t *IdempotencyKeyRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !slices.Contains(t.cfg.Methods, httprequest.Method(req.Method)) || req.Header.Get(string(httprequest.IdempotencyKey)) != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	key := ""
+	if value := reqctx.GetValue(req.Context()); t.cfg.FromContext && value != nil {
+		if inboundKey := IdempotencyKeyValue(value); inboundKey != "" {
+			key = deriveIdempotencyKey(inboundKey, req)
+		}
+	}
+	if key == "" {
+		key = t.cfg.Generate()
+	}
+
+	// RoundTrippers must not modify the original request
+	keyedReq := req.Clone(req.Context())
+	keyedReq.Header.Set(string(httprequest.IdempotencyKey), key)
+	return t.next.RoundTrip(keyedReq)
+}
+
+// deriveIdempotencyKey returns a key unique to the inbound key, method and url of req.
+func deriveIdempotencyKey(inboundKey string, req *http.Request) string {
+	sum := sha256.Sum256([]byte(inboundKey + "\n" + req.Method + "\n" + req.URL.String()))
+	return hex.EncodeToString(sum[:])
+}
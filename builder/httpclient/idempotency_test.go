@@ -0,0 +1,111 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/raythx98/gohelpme/tool/reqctx"
+)
+
+func TestIdempotencyKeyRoundTripper(t *testing.T) {
+	withoutContext := DefaultIdempotencyConfig()
+	withoutContext.FromContext = false
+
+	tests := []struct {
+		name        string
+		cfg         IdempotencyConfig
+		value       *reqctx.Value
+		method      string
+		url         string
+		header      string
+		expectedKey string
+	}{
+		{
+			name:        "Generate key for mutation",
+			cfg:         DefaultIdempotencyConfig(),
+			method:      http.MethodPost,
+			url:         "http://a.com/payments",
+			expectedKey: "generated",
+		},
+		{
+			name:        "Derive key from inbound key",
+			cfg:         DefaultIdempotencyConfig(),
+			value:       reqctx.New("request-id").SetIdempotencyKey("inbound"),
+			method:      http.MethodPost,
+			url:         "http://a.com/payments",
+			expectedKey: "698a3326102b223b82327bc5339d068f86c012e51d1b3cf25517bade2301a7d1",
+		},
+		{
+			name:        "Derive different key for another call",
+			cfg:         DefaultIdempotencyConfig(),
+			value:       reqctx.New("request-id").SetIdempotencyKey("inbound"),
+			method:      http.MethodPut,
+			url:         "http://a.com/payments/1",
+			expectedKey: "60acb48a9414c12fd90f551c6f373d833ceb729a17cf2fb3c77008a77b60a254",
+		},
+		{
+			name:        "Generate key without inbound key",
+			cfg:         DefaultIdempotencyConfig(),
+			value:       reqctx.New("request-id"),
+			method:      http.MethodPost,
+			url:         "http://a.com/payments",
+			expectedKey: "generated",
+		},
+		{
+			name:        "Generate key when not taken from context",
+			cfg:         withoutContext,
+			value:       reqctx.New("request-id").SetIdempotencyKey("inbound"),
+			method:      http.MethodPost,
+			url:         "http://a.com/payments",
+			expectedKey: "generated",
+		},
+		{
+			name:        "Keep key already set on the request",
+			cfg:         DefaultIdempotencyConfig(),
+			value:       reqctx.New("request-id").SetIdempotencyKey("inbound"),
+			method:      http.MethodPost,
+			url:         "http://a.com/payments",
+			header:      "explicit",
+			expectedKey: "explicit",
+		},
+		{
+			name:   "Skip other methods",
+			cfg:    DefaultIdempotencyConfig(),
+			value:  reqctx.New("request-id").SetIdempotencyKey("inbound"),
+			method: http.MethodGet,
+			url:    "http://a.com/payments",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent *http.Request
+			next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				sent = req
+				return newResponse(req, http.StatusOK, ""), nil
+			})
+			tt.cfg.Generate = func() string { return "generated" }
+
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.value != nil {
+				req = req.WithContext(context.WithValue(req.Context(), reqctx.Key, tt.value))
+			}
+			if tt.header != "" {
+				req.Header.Set("Idempotency-Key", tt.header)
+			}
+
+			if _, err := NewIdempotencyKeyRoundTripper(tt.cfg, next).RoundTrip(req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := sent.Header.Get("Idempotency-Key"); got != tt.expectedKey {
+				t.Errorf("expected key %q, got %q", tt.expectedKey, got)
+			}
+			if got := req.Header.Get("Idempotency-Key"); got != tt.header {
+				t.Errorf("expected original request key %q, got %q", tt.header, got)
+			}
+		})
+	}
+}
@@ -1,22 +1,93 @@
 package httpclient
 
 import (
+	"context"
 	"fmt"
 	"github.com/raythx98/gohelpme/tool/logger"
+	"io"
+	"mime"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/raythx98/gohelpme/builder/httprequest"
 	"github.com/raythx98/gohelpme/tool/httphelper"
+	"github.com/raythx98/gohelpme/tool/redactor"
 )
 
+// LogConfig is the configuration for the LogRoundTripper.
+type LogConfig struct {
+	// RedactedPaths are redacted from the logs, same as middleware.LogConfig,
+	// e.g. "request.headers.authorization" or "response.body.access_token".
+	RedactedPaths []string
+	// MaxBodyBytes truncates the logged request and response bodies, 0 logs bodies in full.
+	//
+	// A truncated body cannot be parsed for redaction, so it is redacted entirely if any of its paths are redacted.
+	MaxBodyBytes int64
+	// BodyContentTypes only logs bodies whose media type starts with one of the given prefixes, empty logs all bodies.
+	// Bodies without a Content-Type are always logged.
+	BodyContentTypes []string
+	// SkipRequestBody disables request body capture.
+	SkipRequestBody bool
+	// SkipResponseBody disables response body capture, e.g. for streaming responses.
+	SkipResponseBody bool
+	// CurlOnError adds a curl command reproducing the request to the logs of requests that failed
+	// or got a 4xx or 5xx response, redacted with the "request.headers" and "request.body" RedactedPaths.
+	//
+	// The body is only included if it was captured in full.
+	CurlOnError bool
+}
+
+// DefaultLogConfig returns a LogConfig that redacts credentials, and only logs textual bodies up to 64KiB.
+func DefaultLogConfig() LogConfig {
+	return LogConfig{
+		RedactedPaths: []string{
+			"request.headers.authorization",
+			"request.headers.proxy-authorization",
+			"request.headers.cookie",
+		},
+		MaxBodyBytes: 64 << 10,
+		BodyContentTypes: []string{
+			"application/json",
+			"application/problem+json",
+			"application/xml",
+			"application/x-www-form-urlencoded",
+			"text/plain",
+			"text/html",
+			"text/xml",
+			"text/csv",
+		},
+	}
+}
+
+type skipBodyLogKey struct{}
+
+// WithoutBodyLog returns a copy of ctx that disables body capture for requests sent with it,
+// e.g. for a single streaming download through a shared Client.
+func WithoutBodyLog(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipBodyLogKey{}, true)
+}
+
 // LogRoundTripper is an http.RoundTripper that logs requests and responses.
 type LogRoundTripper struct {
-	log logger.ILogger
+	log  logger.ILogger
+	cfg  LogConfig
+	next http.RoundTripper
 }
 
-// NewLogRoundTripper creates a new LogRoundTripper.
+// NewLogRoundTripper creates a new LogRoundTripper with the DefaultLogConfig.
 func NewLogRoundTripper(log logger.ILogger) *LogRoundTripper {
-	return &LogRoundTripper{log: log}
+	return &LogRoundTripper{log: log, cfg: DefaultLogConfig(), next: http.DefaultTransport}
+}
+
+// Log is a Middleware that logs requests and responses sent through the next http.RoundTripper.
+func Log(log logger.ILogger, cfg LogConfig) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		return &LogRoundTripper{log: log, cfg: cfg, next: next}
+	}
 }
 
 // RoundTrip executes a single HTTP transaction, returning a Response for the provided Request.
@@ -24,15 +95,24 @@ func (t *LogRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	startAt := time.Now()
 	reqLogGroup := t.createRequestLogGroup(req, startAt)
 
-	resp, err := http.DefaultTransport.RoundTrip(req)
+	resp, err := t.next.RoundTrip(req)
 
 	message := fmt.Sprintf("[out-http] %s %s in %s", req.Method, req.URL.String(), time.Since(startAt).String())
 	message += formatMessageSuffix(resp, err)
 
-	t.log.Info(req.Context(), message,
-		logger.WithField("request", reqLogGroup),
-		logger.WithField("response", t.createResponseLogGroup(resp)),
-	)
+	logs := map[string]interface{}{
+		"request":  reqLogGroup,
+		"response": t.createResponseLogGroup(req.Context(), resp),
+	}
+
+	redactedLogs := redactLogs(logs, t.cfg.RedactedPaths)
+	if t.cfg.CurlOnError && (err != nil || resp == nil || resp.StatusCode >= http.StatusBadRequest) {
+		if group, ok := redactedLogs["request"].(map[string]interface{}); ok {
+			group["curl"] = t.curl(req, group)
+		}
+	}
+
+	t.log.Info(req.Context(), message, logger.WithFields(redactedLogs))
 
 	return resp, err
 }
@@ -48,24 +128,101 @@ func formatMessageSuffix(resp *http.Response, err error) string {
 }
 
 func (t *LogRoundTripper) createRequestLogGroup(req *http.Request, startAt time.Time) map[string]interface{} {
-	return map[string]interface{}{
+	group := map[string]interface{}{
 		"endpoint":   fmt.Sprintf("%s %s", req.Method, req.URL.String()),
 		"method":     req.Method,
 		"headers":    req.Header,
-		"body":       httphelper.CopyRequestBody(req),
 		"started at": startAt.Truncate(time.Second),
 	}
+
+	if idempotencyKey := req.Header.Get(string(httprequest.IdempotencyKey)); idempotencyKey != "" {
+		group["idempotency key"] = idempotencyKey
+	}
+
+	if !t.cfg.SkipRequestBody && t.shouldLogBody(req.Context(), req.Header) {
+		body, truncated := httphelper.PeekRequestBody(req, t.cfg.MaxBodyBytes)
+		group["body"] = body
+		if truncated {
+			group["body truncated"] = true
+		}
+	}
+
+	return group
 }
 
-func (t *LogRoundTripper) createResponseLogGroup(resp *http.Response) map[string]interface{} {
+func (t *LogRoundTripper) createResponseLogGroup(ctx context.Context, resp *http.Response) map[string]interface{} {
 	if resp == nil {
 		return nil
 	}
 
-	return map[string]interface{}{
+	group := map[string]interface{}{
 		"status code":  resp.StatusCode,
 		"status":       resp.Status,
-		"body":         httphelper.CopyResponseBody(resp),
 		"completed at": time.Now().Truncate(time.Second),
 	}
+
+	if !t.cfg.SkipResponseBody && t.shouldLogBody(ctx, resp.Header) {
+		body, truncated := httphelper.PeekResponseBody(resp, t.cfg.MaxBodyBytes)
+		group["body"] = body
+		if truncated {
+			group["body truncated"] = true
+		}
+	}
+
+	return group
+}
+
+// shouldLogBody reports whether the body described by headers should be captured.
+func (t *LogRoundTripper) shouldLogBody(ctx context.Context, headers http.Header) bool {
+	if skip, _ := ctx.Value(skipBodyLogKey{}).(bool); skip {
+		return false
+	}
+
+	contentType := headers.Get("Content-Type")
+	if len(t.cfg.BodyContentTypes) == 0 || contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range t.cfg.BodyContentTypes {
+		if strings.HasPrefix(mediaType, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// curl renders the request as a curl command, with the redacted headers and body of its log group.
+func (t *LogRoundTripper) curl(req *http.Request, group map[string]interface{}) string {
+	var redactedHeaders []string
+	for _, path := range t.cfg.RedactedPaths {
+		if name, ok := strings.CutPrefix(path, "request.headers."); ok {
+			redactedHeaders = append(redactedHeaders, name)
+		}
+	}
+
+	curlReq := req.Clone(req.Context())
+	curlReq.Body, curlReq.GetBody = nil, nil
+	if body, ok := group["body"].(string); ok && body != "" && group["body truncated"] != true {
+		curlReq.Body = io.NopCloser(strings.NewReader(body))
+	}
+
+	return httprequest.ToCurl(curlReq, redactedHeaders...)
+}
+
+// redactLogs redacts the given paths, redacting truncated bodies entirely as they cannot be parsed.
+func redactLogs(logs map[string]interface{}, redactedPaths []string) map[string]interface{} {
+	for _, path := range redactedPaths {
+		groupName, rest, _ := strings.Cut(path, ".")
+		group, ok := logs[groupName].(map[string]interface{})
+		if !ok || group["body truncated"] != true || !strings.HasPrefix(rest, "body.") {
+			continue
+		}
+		group["body"] = redactor.RedactedValue
+	}
+
+	return redactor.Redact(logs, redactedPaths)
 }
@@ -0,0 +1,204 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+
+	mocklogger "github.com/raythx98/gohelpme/mocks/github.com/raythx98/gohelpme/tool/logger"
+	"github.com/raythx98/gohelpme/tool/logger"
+	"github.com/raythx98/gohelpme/tool/redactor"
+)
+
+func TestLogRoundTripper(t *testing.T) {
+	tests := []struct {
+		name              string
+		cfg               LogConfig
+		ctx               context.Context
+		reqHeaders        map[string]string
+		reqBody           string
+		respStatus        int
+		respContentType   string
+		respBody          string
+		expectedRequest   map[string]interface{}
+		expectedResponse  map[string]interface{}
+		expectedCurlParts []string
+	}{
+		{
+			name:            "Redact headers and body fields",
+			cfg:             LogConfig{RedactedPaths: []string{"request.headers.authorization", "response.body.token"}},
+			reqHeaders:      map[string]string{"Authorization": "Bearer secret"},
+			respStatus:      http.StatusOK,
+			respContentType: "application/json",
+			respBody:        `{"token":"secret","user":"alice"}`,
+			expectedRequest: map[string]interface{}{
+				"headers": map[string]interface{}{"Authorization": []interface{}{redactor.RedactedValue}},
+			},
+			expectedResponse: map[string]interface{}{
+				"body": `{"token":"` + redactor.RedactedValue + `","user":"alice"}`,
+			},
+		},
+		{
+			name:       "Truncate bodies over MaxBodyBytes",
+			cfg:        LogConfig{MaxBodyBytes: 5},
+			reqBody:    "0123456789",
+			respStatus: http.StatusOK,
+			respBody:   "abcdefghij",
+			expectedRequest: map[string]interface{}{
+				"body":           "01234",
+				"body truncated": true,
+			},
+			expectedResponse: map[string]interface{}{
+				"body":           "abcde",
+				"body truncated": true,
+			},
+		},
+		{
+			name:       "Redact truncated body entirely",
+			cfg:        LogConfig{MaxBodyBytes: 5, RedactedPaths: []string{"request.body.password"}},
+			reqBody:    `{"password":"secret"}`,
+			respStatus: http.StatusOK,
+			expectedRequest: map[string]interface{}{
+				"body": redactor.RedactedValue,
+			},
+		},
+		{
+			name:             "Skip body of content type not allowed",
+			cfg:              LogConfig{BodyContentTypes: []string{"application/json"}},
+			respStatus:       http.StatusOK,
+			respContentType:  "image/png",
+			respBody:         "binary",
+			expectedResponse: map[string]interface{}{"body": nil},
+		},
+		{
+			name:             "Skip bodies for WithoutBodyLog",
+			ctx:              WithoutBodyLog(context.Background()),
+			reqBody:          "request",
+			respStatus:       http.StatusOK,
+			respBody:         "response",
+			expectedRequest:  map[string]interface{}{"body": nil},
+			expectedResponse: map[string]interface{}{"body": nil},
+		},
+		{
+			name: "Add redacted curl on error",
+			cfg: LogConfig{
+				RedactedPaths: []string{"request.headers.authorization"},
+				CurlOnError:   true,
+			},
+			reqHeaders:        map[string]string{"Authorization": "Bearer secret"},
+			reqBody:           `{"amount":1}`,
+			respStatus:        http.StatusInternalServerError,
+			expectedCurlParts: []string{"curl", "-X 'POST'", "Authorization: " + redactor.RedactedValue, `{"amount":1}`},
+		},
+		{
+			name:            "Do not add curl on success",
+			cfg:             LogConfig{CurlOnError: true},
+			respStatus:      http.StatusOK,
+			expectedRequest: map[string]interface{}{"curl": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sentBody string
+			next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				body, _ := io.ReadAll(req.Body)
+				sentBody = string(body)
+
+				resp := newResponse(req, tt.respStatus, tt.respBody)
+				if tt.respContentType != "" {
+					resp.Header.Set("Content-Type", tt.respContentType)
+				}
+				return resp, nil
+			})
+
+			var logs map[string]interface{}
+			log := mocklogger.NewMockILogger(t)
+			log.EXPECT().Info(mock.Anything, mock.Anything, mock.Anything).
+				Run(func(ctx context.Context, msg string, fields ...logger.Field) {
+					logs = fields[0]()
+				})
+
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			req := httptest.NewRequest(http.MethodPost, "http://example.com/users", strings.NewReader(tt.reqBody)).WithContext(ctx)
+			for k, v := range tt.reqHeaders {
+				req.Header.Set(k, v)
+			}
+
+			resp, err := Log(log, tt.cfg)(next).RoundTrip(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			respBody, _ := io.ReadAll(resp.Body)
+
+			if sentBody != tt.reqBody {
+				t.Errorf("expected request body %q to be sent, got %q", tt.reqBody, sentBody)
+			}
+			if string(respBody) != tt.respBody {
+				t.Errorf("expected response body %q to be returned, got %q", tt.respBody, string(respBody))
+			}
+
+			requestGroup, _ := logs["request"].(map[string]interface{})
+			responseGroup, _ := logs["response"].(map[string]interface{})
+			assertLogGroup(t, "request", requestGroup, tt.expectedRequest)
+			assertLogGroup(t, "response", responseGroup, tt.expectedResponse)
+
+			for _, part := range tt.expectedCurlParts {
+				if curl, _ := requestGroup["curl"].(string); !strings.Contains(curl, part) {
+					t.Errorf("expected curl to contain %q, got %q", part, curl)
+				}
+			}
+		})
+	}
+}
+
+// assertLogGroup checks the expected fields of a log group, a nil expected value means the field is absent.
+func assertLogGroup(t *testing.T, name string, group, expected map[string]interface{}) {
+	t.Helper()
+	for key, value := range expected {
+		got, ok := group[key]
+		if value == nil {
+			if ok {
+				t.Errorf("expected %s %s to be absent, got %v", name, key, got)
+			}
+			continue
+		}
+		if expectedHeaders, isMap := value.(map[string]interface{}); isMap {
+			headers, _ := got.(map[string]interface{})
+			for header, headerValue := range expectedHeaders {
+				if !equalLogValues(headers[header], headerValue) {
+					t.Errorf("expected %s header %s %v, got %v", name, header, headerValue, headers[header])
+				}
+			}
+			continue
+		}
+		if !equalLogValues(got, value) {
+			t.Errorf("expected %s %s %v, got %v", name, key, value, got)
+		}
+	}
+}
+
+func equalLogValues(a, b interface{}) bool {
+	as, aok := a.([]interface{})
+	bs, bok := b.([]interface{})
+	if aok && bok {
+		if len(as) != len(bs) {
+			return false
+		}
+		for i := range as {
+			if as[i] != bs[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
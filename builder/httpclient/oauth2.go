@@ -0,0 +1,236 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raythx98/gohelpme/builder/httprequest"
+)
+
+// OAuth2AuthStyle is how the client credentials are sent to the token endpoint.
+// It can be either OAuth2AuthHeader or OAuth2AuthParams.
+type OAuth2AuthStyle string
+
+const (
+	// OAuth2AuthHeader sends the client credentials in a basic `Authorization` header.
+	OAuth2AuthHeader OAuth2AuthStyle = "header"
+	// OAuth2AuthParams sends the client credentials as form parameters in the body.
+	OAuth2AuthParams OAuth2AuthStyle = "params"
+)
+
+// OAuth2ConfigProvider is the interface that wraps the GetOAuth2ClientId and GetOAuth2ClientSecret methods.
+type OAuth2ConfigProvider interface {
+	GetOAuth2ClientId() string
+	GetOAuth2ClientSecret() []byte
+}
+
+// OAuth2Config is the configuration for the OAuth2RoundTripper.
+type OAuth2Config struct {
+	TokenUrl string
+	Scopes   []string
+	// EndpointParams are additional form parameters sent to the token endpoint, e.g. `audience`.
+	EndpointParams map[string]string
+	// AuthStyle defaults to OAuth2AuthHeader.
+	AuthStyle OAuth2AuthStyle
+	// ExpiryLeeway refreshes tokens this long before they expire.
+	ExpiryLeeway time.Duration
+	// TokenClient sends the token requests, defaults to an http.Client with a 30 second timeout.
+	TokenClient IClient
+}
+
+// OAuth2Token is a token issued by the token endpoint.
+type OAuth2Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	// ExpiresAt is zero if the token endpoint did not return an expiry.
+	ExpiresAt time.Time `json:"-"`
+}
+
+// OAuth2RoundTripper is an http.RoundTripper that authenticates requests with OAuth2 client-credentials bearer tokens.
+//
+// Tokens are cached until shortly before they expire, and fetched once for all concurrent requests.
+// A request rejected with 401 Unauthorized is retried once with a new token.
+type OAuth2RoundTripper struct {
+	cfg      OAuth2Config
+	provider OAuth2ConfigProvider
+	next     http.RoundTripper
+
+	mu       sync.Mutex
+	token    *OAuth2Token
+	inFlight *tokenCall
+}
+
+type tokenCall struct {
+	done  chan struct{}
+	token *OAuth2Token
+	err   error
+}
+
+// NewOAuth2RoundTripper creates a new OAuth2RoundTripper that sends requests through next.
+//
+// If next is nil, http.DefaultTransport is used.
+func NewOAuth2RoundTripper(cfg OAuth2Config, provider OAuth2ConfigProvider, next http.RoundTripper) *OAuth2RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if cfg.AuthStyle == "" {
+		cfg.AuthStyle = OAuth2AuthHeader
+	}
+	if cfg.TokenClient == nil {
+		cfg.TokenClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &OAuth2RoundTripper{cfg: cfg, provider: provider, next: next}
+}
+
+// OAuth2 is a Middleware that authenticates requests sent through the next http.RoundTripper with OAuth2 bearer tokens.
+func OAuth2(cfg OAuth2Config, provider OAuth2ConfigProvider) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewOAuth2RoundTripper(cfg, provider, next)
+	}
+}
+
+// RoundTrip executes a single HTTP transaction with a bearer token, retrying once with a new token on 401 Unauthorized.
+func (t *OAuth2RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	getBody := rewindBody(req)
+	resp, err := t.send(req, getBody, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	drainBody(resp)
+	t.invalidate(token)
+	if token, err = t.Token(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.send(req, getBody, token)
+}
+
+func (t *OAuth2RoundTripper) send(req *http.Request, getBody func() (io.ReadCloser, error), token *OAuth2Token) (*http.Response, error) {
+	// RoundTrippers must not modify the original request
+	authReq, err := cloneRequest(req, getBody)
+	if err != nil {
+		return nil, err
+	}
+	authReq.Header.Set(string(httprequest.Authorization), "Bearer "+token.AccessToken)
+	return t.next.RoundTrip(authReq)
+}
+
+// Token returns the cached token, fetching a new one if it is missing or about to expire.
+//
+// Concurrent callers share a single fetch.
+func (t *OAuth2RoundTripper) Token(ctx context.Context) (*OAuth2Token, error) {
+	t.mu.Lock()
+	if t.token != nil && t.isValid(t.token) {
+		token := t.token
+		t.mu.Unlock()
+		return token, nil
+	}
+
+	call := t.inFlight
+	if call == nil {
+		call = &tokenCall{done: make(chan struct{})}
+		t.inFlight = call
+		// The fetch is shared, so it must not be cancelled by the caller that happened to start it
+		go t.fetch(context.WithoutCancel(ctx), call)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.done:
+		return call.token, call.err
+	}
+}
+
+func (t *OAuth2RoundTripper) isValid(token *OAuth2Token) bool {
+	return token.ExpiresAt.IsZero() || time.Now().Add(t.cfg.ExpiryLeeway).Before(token.ExpiresAt)
+}
+
+// invalidate drops the cached token if it is still the given one.
+func (t *OAuth2RoundTripper) invalidate(token *OAuth2Token) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token == token {
+		t.token = nil
+	}
+}
+
+func (t *OAuth2RoundTripper) fetch(ctx context.Context, call *tokenCall) {
+	call.token, call.err = t.requestToken(ctx)
+
+	t.mu.Lock()
+	if call.err == nil {
+		t.token = call.token
+	}
+	t.inFlight = nil
+	t.mu.Unlock()
+
+	close(call.done)
+}
+
+func (t *OAuth2RoundTripper) requestToken(ctx context.Context) (*OAuth2Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(t.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(t.cfg.Scopes, " "))
+	}
+	for k, v := range t.cfg.EndpointParams {
+		form.Set(k, v)
+	}
+
+	clientId, clientSecret := t.provider.GetOAuth2ClientId(), string(t.provider.GetOAuth2ClientSecret())
+	if t.cfg.AuthStyle == OAuth2AuthParams {
+		form.Set("client_id", clientId)
+		form.Set("client_secret", clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.cfg.TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set(string(httprequest.ContentTypeKey), string(httprequest.ApplicationFormUrlEncoded))
+	if t.cfg.AuthStyle == OAuth2AuthHeader {
+		req.SetBasicAuth(url.QueryEscape(clientId), url.QueryEscape(clientSecret))
+	}
+
+	resp, err := t.cfg.TokenClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("failed to request token: %w", newResponseError(resp, body))
+	}
+
+	token := &OAuth2Token{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("failed to request token: empty access token")
+	}
+	if token.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
@@ -0,0 +1,220 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type oauth2TestProvider struct{}
+
+func (oauth2TestProvider) GetOAuth2ClientId() string     { return "client" }
+func (oauth2TestProvider) GetOAuth2ClientSecret() []byte { return []byte("secret") }
+
+// newTokenServer returns a token endpoint issuing "token-1", "token-2", ... and counting the tokens issued.
+func newTokenServer(t *testing.T, expiresIn int64, authStyle OAuth2AuthStyle, release <-chan struct{}) (*httptest.Server, *atomic.Int32) {
+	var issued atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if release != nil {
+			<-release
+		}
+		_ = r.ParseForm()
+		clientId, clientSecret, _ := r.BasicAuth()
+		if authStyle == OAuth2AuthParams {
+			clientId, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+		if clientId != "client" || clientSecret != "secret" || r.PostForm.Get("grant_type") != "client_credentials" {
+			t.Errorf("unexpected token request %v", r.PostForm)
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d", issued.Add(1)),
+			"token_type":   "Bearer",
+			"expires_in":   expiresIn,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &issued
+}
+
+func TestOAuth2RoundTripper(t *testing.T) {
+	tests := []struct {
+		name               string
+		authStyle          OAuth2AuthStyle
+		expiresIn          int64
+		unauthorizedTokens []string
+		requests           int
+		expectedStatus     int
+		expectedTokens     int32
+		expectedApiCalls   int32
+		expectedLastBearer string
+	}{
+		{
+			name:               "Cache token across requests",
+			expiresIn:          3600,
+			requests:           2,
+			expectedStatus:     http.StatusOK,
+			expectedTokens:     1,
+			expectedApiCalls:   2,
+			expectedLastBearer: "Bearer token-1",
+		},
+		{
+			name:               "Send credentials as form params",
+			authStyle:          OAuth2AuthParams,
+			expiresIn:          3600,
+			requests:           1,
+			expectedStatus:     http.StatusOK,
+			expectedTokens:     1,
+			expectedApiCalls:   1,
+			expectedLastBearer: "Bearer token-1",
+		},
+		{
+			name:               "Refresh token within expiry leeway",
+			expiresIn:          1,
+			requests:           2,
+			expectedStatus:     http.StatusOK,
+			expectedTokens:     2,
+			expectedApiCalls:   2,
+			expectedLastBearer: "Bearer token-2",
+		},
+		{
+			name:               "Refresh token and retry once on 401",
+			expiresIn:          3600,
+			unauthorizedTokens: []string{"Bearer token-1"},
+			requests:           1,
+			expectedStatus:     http.StatusOK,
+			expectedTokens:     2,
+			expectedApiCalls:   2,
+			expectedLastBearer: "Bearer token-2",
+		},
+		{
+			name:               "Return 401 when the new token is rejected too",
+			expiresIn:          3600,
+			unauthorizedTokens: []string{"Bearer token-1", "Bearer token-2"},
+			requests:           1,
+			expectedStatus:     http.StatusUnauthorized,
+			expectedTokens:     2,
+			expectedApiCalls:   2,
+			expectedLastBearer: "Bearer token-2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenServer, issued := newTokenServer(t, tt.expiresIn, tt.authStyle, nil)
+
+			var apiCalls atomic.Int32
+			var lastBearer string
+			next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				apiCalls.Add(1)
+				lastBearer = req.Header.Get("Authorization")
+				if body, _ := io.ReadAll(req.Body); string(body) != `{"amount":1}` {
+					t.Errorf("expected body to be sent on every attempt, got %q", string(body))
+				}
+				for _, token := range tt.unauthorizedTokens {
+					if lastBearer == token {
+						return newResponse(req, http.StatusUnauthorized, ""), nil
+					}
+				}
+				return newResponse(req, http.StatusOK, ""), nil
+			})
+
+			transport := NewOAuth2RoundTripper(OAuth2Config{
+				TokenUrl:     tokenServer.URL,
+				AuthStyle:    tt.authStyle,
+				ExpiryLeeway: time.Second,
+			}, oauth2TestProvider{}, next)
+
+			var resp *http.Response
+			for i := 0; i < tt.requests; i++ {
+				req := httptest.NewRequest(http.MethodPost, "http://example.com/payments", strings.NewReader(`{"amount":1}`))
+				var err error
+				if resp, err = transport.RoundTrip(req); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if req.Header.Get("Authorization") != "" {
+					t.Errorf("expected original request to be unchanged")
+				}
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if got := issued.Load(); got != tt.expectedTokens {
+				t.Errorf("expected %d tokens issued, got %d", tt.expectedTokens, got)
+			}
+			if got := apiCalls.Load(); got != tt.expectedApiCalls {
+				t.Errorf("expected %d api calls, got %d", tt.expectedApiCalls, got)
+			}
+			if lastBearer != tt.expectedLastBearer {
+				t.Errorf("expected last Authorization %q, got %q", tt.expectedLastBearer, lastBearer)
+			}
+		})
+	}
+}
+
+func TestOAuth2RoundTripperSingleFlight(t *testing.T) {
+	release := make(chan struct{})
+	tokenServer, issued := newTokenServer(t, 3600, OAuth2AuthHeader, release)
+	transport := NewOAuth2RoundTripper(OAuth2Config{TokenUrl: tokenServer.URL}, oauth2TestProvider{}, nil)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	tokens := make([]string, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := transport.Token(context.Background())
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			tokens[i] = token.AccessToken
+		}()
+	}
+
+	// Give every caller time to wait on the fetch before the token endpoint answers
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := issued.Load(); got != 1 {
+		t.Errorf("expected 1 token issued, got %d", got)
+	}
+	for _, token := range tokens {
+		if token != "token-1" {
+			t.Errorf("expected every caller to get token-1, got %q", token)
+		}
+	}
+}
+
+func TestOAuth2RoundTripperCancelledCaller(t *testing.T) {
+	release := make(chan struct{})
+	tokenServer, issued := newTokenServer(t, 3600, OAuth2AuthHeader, release)
+	transport := NewOAuth2RoundTripper(OAuth2Config{TokenUrl: tokenServer.URL}, oauth2TestProvider{}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := transport.Token(ctx); err == nil {
+		t.Fatalf("expected error for cancelled caller")
+	}
+
+	// The fetch started by the cancelled caller still completes for the next one
+	close(release)
+	token, err := transport.Token(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.AccessToken != "token-1" || issued.Load() != 1 {
+		t.Errorf("expected the shared fetch to be reused, got %s after %d tokens", token.AccessToken, issued.Load())
+	}
+}
@@ -0,0 +1,165 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned when a request is rejected by the RateLimitRoundTripper in FailFast mode.
+var ErrRateLimited = errors.New("outbound rate limit exceeded")
+
+// RateConfig is the limit applied to a host or route, 0 values are unlimited.
+type RateConfig struct {
+	Rate        float64 `yaml:"rate" json:"rate"`
+	Burst       int     `yaml:"burst" json:"burst"`
+	MaxInFlight int     `yaml:"maxInFlight" json:"maxInFlight"`
+}
+
+// RateLimitConfig is the configuration for the RateLimitRoundTripper.
+type RateLimitConfig struct {
+	// Default is applied to every host without its own limit, each host getting its own bucket.
+	Default RateConfig `yaml:"default" json:"default"`
+	// Hosts are keyed by the host of the request URL, e.g. "api.partner.com".
+	Hosts map[string]RateConfig `yaml:"hosts" json:"hosts"`
+	// Routes are keyed by "METHOD:host/path", e.g. "POST:api.partner.com/v1/payments", and take precedence over Hosts.
+	Routes map[string]RateConfig `yaml:"routes" json:"routes"`
+	// FailFast rejects requests over the limit with ErrRateLimited instead of waiting.
+	FailFast bool `yaml:"failFast" json:"failFast"`
+}
+
+// RateLimitRoundTripper is an http.RoundTripper that enforces token-bucket limits and maximum in-flight requests
+// per host or route, to stay within the quotas of downstream APIs.
+type RateLimitRoundTripper struct {
+	cfg  RateLimitConfig
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	limiters map[string]*outboundLimiter
+}
+
+type outboundLimiter struct {
+	limiter *rate.Limiter
+	slots   chan struct{}
+}
+
+// NewRateLimitRoundTripper creates a new RateLimitRoundTripper that sends requests through next.
+//
+// If next is nil, http.DefaultTransport is used.
+func NewRateLimitRoundTripper(cfg RateLimitConfig, next http.RoundTripper) *RateLimitRoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &RateLimitRoundTripper{
+		cfg:      cfg,
+		next:     next,
+		limiters: make(map[string]*outboundLimiter),
+	}
+}
+
+// RateLimit is a Middleware that rate limits requests sent through the next http.RoundTripper.
+func RateLimit(cfg RateLimitConfig) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewRateLimitRoundTripper(cfg, next)
+	}
+}
+
+// RoundTrip waits for the limits of the request host or route, or rejects it in FailFast mode,
+// then executes a single HTTP transaction.
+//
+// The in-flight slot is held until the response body is closed.
+func (t *RateLimitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, limiter := t.getLimiter(req)
+
+	if err := limiter.acquire(req.Context(), t.cfg.FailFast); err != nil {
+		if errors.Is(err, ErrRateLimited) {
+			return nil, fmt.Errorf("%w: %s", err, key)
+		}
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		limiter.release()
+		return nil, err
+	}
+
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: limiter.release}
+	return resp, nil
+}
+
+// getLimiter returns the limiter of the request route if configured, otherwise the one of its host.
+func (t *RateLimitRoundTripper) getLimiter(req *http.Request) (string, *outboundLimiter) {
+	key := fmt.Sprintf("%s:%s%s", req.Method, req.URL.Host, req.URL.Path)
+	cfg, ok := t.cfg.Routes[key]
+	if !ok {
+		key = req.URL.Host
+		if cfg, ok = t.cfg.Hosts[key]; !ok {
+			cfg = t.cfg.Default
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	limiter, ok := t.limiters[key]
+	if !ok {
+		limiter = newOutboundLimiter(cfg)
+		t.limiters[key] = limiter
+	}
+	return key, limiter
+}
+
+func newOutboundLimiter(cfg RateConfig) *outboundLimiter {
+	limiter := &outboundLimiter{limiter: rate.NewLimiter(rate.Inf, 0)}
+	if cfg.Rate > 0 {
+		limiter.limiter = rate.NewLimiter(rate.Limit(cfg.Rate), max(cfg.Burst, 1))
+	}
+	if cfg.MaxInFlight > 0 {
+		limiter.slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+	return limiter
+}
+
+// acquire takes an in-flight slot and a token, waiting for both unless failFast is set.
+func (l *outboundLimiter) acquire(ctx context.Context, failFast bool) error {
+	if l.slots != nil {
+		if failFast {
+			select {
+			case l.slots <- struct{}{}:
+			default:
+				return ErrRateLimited
+			}
+		} else {
+			select {
+			case l.slots <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	if failFast {
+		if !l.limiter.Allow() {
+			l.release()
+			return ErrRateLimited
+		}
+		return nil
+	}
+
+	if err := l.limiter.Wait(ctx); err != nil {
+		l.release()
+		return err
+	}
+	return nil
+}
+
+func (l *outboundLimiter) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
@@ -0,0 +1,133 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestRateLimitRoundTripper(t *testing.T) {
+	type request struct {
+		method    string
+		url       string
+		keepOpen  bool
+		cancelled bool
+	}
+
+	tests := []struct {
+		name           string
+		cfg            RateLimitConfig
+		requests       []request
+		expectedErrors []error
+	}{
+		{
+			name: "Reject requests over burst in fail fast",
+			cfg:  RateLimitConfig{Default: RateConfig{Rate: 0.001, Burst: 2}, FailFast: true},
+			requests: []request{
+				{method: http.MethodGet, url: "http://a.com/users"},
+				{method: http.MethodGet, url: "http://a.com/users"},
+				{method: http.MethodGet, url: "http://a.com/users"},
+			},
+			expectedErrors: []error{nil, nil, ErrRateLimited},
+		},
+		{
+			name: "Keep a bucket per host",
+			cfg:  RateLimitConfig{Default: RateConfig{Rate: 0.001, Burst: 1}, FailFast: true},
+			requests: []request{
+				{method: http.MethodGet, url: "http://a.com/users"},
+				{method: http.MethodGet, url: "http://b.com/users"},
+				{method: http.MethodGet, url: "http://a.com/orders"},
+			},
+			expectedErrors: []error{nil, nil, ErrRateLimited},
+		},
+		{
+			name: "Use route over host limit",
+			cfg: RateLimitConfig{
+				Hosts:    map[string]RateConfig{"a.com": {Rate: 0.001, Burst: 1}},
+				Routes:   map[string]RateConfig{"POST:a.com/payments": {Rate: 0.001, Burst: 2}},
+				FailFast: true,
+			},
+			requests: []request{
+				{method: http.MethodPost, url: "http://a.com/payments"},
+				{method: http.MethodPost, url: "http://a.com/payments"},
+				{method: http.MethodGet, url: "http://a.com/users"},
+				{method: http.MethodGet, url: "http://a.com/users"},
+			},
+			expectedErrors: []error{nil, nil, nil, ErrRateLimited},
+		},
+		{
+			name: "Hold in-flight slot until body is closed",
+			cfg:  RateLimitConfig{Default: RateConfig{MaxInFlight: 1}, FailFast: true},
+			requests: []request{
+				{method: http.MethodGet, url: "http://a.com/users", keepOpen: true},
+				{method: http.MethodGet, url: "http://a.com/users"},
+			},
+			expectedErrors: []error{nil, ErrRateLimited},
+		},
+		{
+			name: "Release in-flight slot once body is closed",
+			cfg:  RateLimitConfig{Default: RateConfig{MaxInFlight: 1}, FailFast: true},
+			requests: []request{
+				{method: http.MethodGet, url: "http://a.com/users"},
+				{method: http.MethodGet, url: "http://a.com/users"},
+			},
+			expectedErrors: []error{nil, nil},
+		},
+		{
+			name: "Stop waiting when the context is cancelled",
+			cfg:  RateLimitConfig{Default: RateConfig{Rate: 0.001, Burst: 1}},
+			requests: []request{
+				{method: http.MethodGet, url: "http://a.com/users"},
+				{method: http.MethodGet, url: "http://a.com/users", cancelled: true},
+			},
+			expectedErrors: []error{nil, context.Canceled},
+		},
+		{
+			name: "Allow everything without limits",
+			cfg:  RateLimitConfig{FailFast: true},
+			requests: []request{
+				{method: http.MethodGet, url: "http://a.com/users"},
+				{method: http.MethodGet, url: "http://a.com/users"},
+				{method: http.MethodGet, url: "http://a.com/users"},
+			},
+			expectedErrors: []error{nil, nil, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return newResponse(req, http.StatusOK, ""), nil
+			})
+			transport := NewRateLimitRoundTripper(tt.cfg, next)
+
+			var errs []error
+			for _, r := range tt.requests {
+				ctx := context.Background()
+				if r.cancelled {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithCancel(ctx)
+					cancel()
+				}
+
+				resp, err := transport.RoundTrip(httptest.NewRequest(r.method, r.url, nil).WithContext(ctx))
+				errs = append(errs, err)
+				if err == nil && !r.keepOpen {
+					_ = resp.Body.Close()
+				}
+			}
+
+			if !slices.EqualFunc(errs, tt.expectedErrors, func(err, expected error) bool {
+				if expected == nil {
+					return err == nil
+				}
+				return errors.Is(err, expected)
+			}) {
+				t.Errorf("expected errors %v, got %v", tt.expectedErrors, errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/raythx98/gohelpme/tool/httphelper"
+	"github.com/raythx98/gohelpme/tool/redactor"
+)
+
+// ErrInteractionNotFound is returned when no recorded interaction matches a request in ModeReplay.
+var ErrInteractionNotFound = errors.New("no recorded interaction matches the request")
+
+// RecorderMode is the mode of the RecorderRoundTripper.
+// It can be either ModeRecord, ModeReplay or ModeReplayOrRecord.
+type RecorderMode string
+
+const (
+	// ModeRecord sends every request and records it, overwriting the cassette.
+	ModeRecord RecorderMode = "record"
+	// ModeReplay serves every request from the cassette, without sending it.
+	ModeReplay RecorderMode = "replay"
+	// ModeReplayOrRecord serves requests from the cassette, sending and recording the ones that are not found.
+	ModeReplayOrRecord RecorderMode = "replay-or-record"
+)
+
+// Cassette is the file format of recorded interactions.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and response pair.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a recorded http.Request.
+type RecordedRequest struct {
+	Method  string      `json:"method"`
+	Url     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+	// Base64 is set when Body is base64 encoded, as it is not valid UTF-8.
+	Base64 bool `json:"base64,omitempty"`
+}
+
+// RecordedResponse is a recorded http.Response.
+type RecordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	// Base64 is set when Body is base64 encoded, as it is not valid UTF-8.
+	Base64 bool `json:"base64,omitempty"`
+}
+
+// MatchConfig configures which parts of a request must match a recorded request to replay it.
+type MatchConfig struct {
+	Method bool
+	// Url matches the scheme, host and path.
+	Url   bool
+	Query bool
+	// Body matches the body, ignoring formatting differences for JSON bodies.
+	Body bool
+}
+
+// RecorderConfig is the configuration for the RecorderRoundTripper.
+type RecorderConfig struct {
+	CassettePath string
+	Mode         RecorderMode
+	Match        MatchConfig
+	// RedactedPaths are redacted before interactions are saved, same as LogConfig,
+	// e.g. "request.headers.authorization" or "response.body.access_token".
+	//
+	// Incoming requests are redacted the same way before being matched in replay.
+	RedactedPaths []string
+	// BeforeSave is called on every interaction before it is saved, e.g. for custom redaction.
+	BeforeSave func(i *Interaction)
+}
+
+// DefaultRecorderConfig returns a RecorderConfig that matches on every part of the request and redacts credentials.
+func DefaultRecorderConfig(cassettePath string, mode RecorderMode) RecorderConfig {
+	return RecorderConfig{
+		CassettePath: cassettePath,
+		Mode:         mode,
+		Match:        MatchConfig{Method: true, Url: true, Query: true, Body: true},
+		RedactedPaths: []string{
+			"request.headers.authorization",
+			"request.headers.proxy-authorization",
+			"request.headers.cookie",
+			"response.headers.set-cookie",
+		},
+	}
+}
+
+// RecorderRoundTripper is an http.RoundTripper that records interactions to a cassette file and replays them,
+// so that tests of code calling third parties run offline and repeatably.
+//
+// It is meant to be the base transport of a Client:
+//
+//	recorder, err := httpclient.NewRecorderRoundTripper(httpclient.DefaultRecorderConfig("testdata/users.json", httpclient.ModeReplay), nil)
+//	client := httpclient.NewWithOptions(httpclient.WithBaseTransport(recorder))
+type RecorderRoundTripper struct {
+	cfg  RecorderConfig
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	cassette *Cassette
+	replayed map[*Interaction]bool
+}
+
+// NewRecorderRoundTripper creates a new RecorderRoundTripper that sends requests to be recorded through next.
+//
+// If next is nil, http.DefaultTransport is used.
+// It returns an error if the cassette is needed for replay but cannot be read.
+func NewRecorderRoundTripper(cfg RecorderConfig, next http.RoundTripper) (*RecorderRoundTripper, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	cassette := &Cassette{}
+	if cfg.Mode != ModeRecord {
+		data, err := os.ReadFile(cfg.CassettePath)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, cassette); err != nil {
+				return nil, fmt.Errorf("failed to decode cassette: %w", err)
+			}
+		case !errors.Is(err, os.ErrNotExist) || cfg.Mode == ModeReplay:
+			return nil, fmt.Errorf("failed to read cassette: %w", err)
+		}
+	}
+
+	return &RecorderRoundTripper{
+		cfg:      cfg,
+		next:     next,
+		cassette: cassette,
+		replayed: make(map[*Interaction]bool),
+	}, nil
+}
+
+// RoundTrip replays or records a single HTTP transaction according to the RecorderMode.
+func (t *RecorderRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	recordedReq := newRecordedRequest(req)
+
+	if t.cfg.Mode != ModeRecord {
+		if interaction := t.find(&t.redact(&Interaction{Request: recordedReq}).Request); interaction != nil {
+			return interaction.Response.toResponse(req)
+		}
+		if t.cfg.Mode == ModeReplay {
+			return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, req.Method, req.URL.String())
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	interaction := &Interaction{
+		Request:  recordedReq,
+		Response: newRecordedResponse(resp),
+	}
+	if err := t.save(interaction); err != nil {
+		drainBody(resp)
+		return nil, err
+	}
+	return resp, nil
+}
+
+// find returns the first matching interaction that has not been replayed yet,
+// or the last matching one if all of them have been.
+func (t *RecorderRoundTripper) find(req *RecordedRequest) *Interaction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var found *Interaction
+	for _, interaction := range t.cassette.Interactions {
+		if !t.matches(req, &interaction.Request) {
+			continue
+		}
+		found = interaction
+		if !t.replayed[interaction] {
+			break
+		}
+	}
+
+	if found != nil {
+		t.replayed[found] = true
+	}
+	return found
+}
+
+func (t *RecorderRoundTripper) matches(req *RecordedRequest, recorded *RecordedRequest) bool {
+	if t.cfg.Match.Method && req.Method != recorded.Method {
+		return false
+	}
+
+	reqUrl, err := url.Parse(req.Url)
+	if err != nil {
+		return false
+	}
+	recordedUrl, err := url.Parse(recorded.Url)
+	if err != nil {
+		return false
+	}
+	if t.cfg.Match.Url && (reqUrl.Scheme != recordedUrl.Scheme || reqUrl.Host != recordedUrl.Host || reqUrl.Path != recordedUrl.Path) {
+		return false
+	}
+	if t.cfg.Match.Query && reqUrl.Query().Encode() != recordedUrl.Query().Encode() {
+		return false
+	}
+
+	return !t.cfg.Match.Body || (req.Base64 == recorded.Base64 && equalBodies(req.Body, recorded.Body))
+}
+
+// save redacts the interaction and writes the cassette to disk.
+func (t *RecorderRoundTripper) save(interaction *Interaction) error {
+	interaction = t.redact(interaction)
+	if t.cfg.BeforeSave != nil {
+		t.cfg.BeforeSave(interaction)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cassette.Interactions = append(t.cassette.Interactions, interaction)
+	t.replayed[interaction] = true
+
+	data, err := json.MarshalIndent(t.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.cfg.CassettePath), 0o755); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	if err := os.WriteFile(t.cfg.CassettePath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// redact returns a copy of the interaction with the RedactedPaths redacted.
+func (t *RecorderRoundTripper) redact(interaction *Interaction) *Interaction {
+	if len(t.cfg.RedactedPaths) == 0 {
+		return interaction
+	}
+
+	var logs map[string]interface{}
+	data, _ := json.Marshal(interaction)
+	if err := json.Unmarshal(data, &logs); err != nil {
+		return interaction
+	}
+
+	redacted := &Interaction{}
+	data, _ = json.Marshal(redactor.Redact(logs, t.cfg.RedactedPaths))
+	if err := json.Unmarshal(data, redacted); err != nil {
+		return interaction
+	}
+	return redacted
+}
+
+func newRecordedRequest(req *http.Request) RecordedRequest {
+	body, isBase64 := encodeBody(httphelper.CopyRequestBody(req))
+	return RecordedRequest{
+		Method:  req.Method,
+		Url:     req.URL.String(),
+		Headers: req.Header.Clone(),
+		Body:    body,
+		Base64:  isBase64,
+	}
+}
+
+func newRecordedResponse(resp *http.Response) RecordedResponse {
+	body, isBase64 := encodeBody(httphelper.CopyResponseBody(resp))
+	return RecordedResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    resp.Header.Clone(),
+		Body:       body,
+		Base64:     isBase64,
+	}
+}
+
+func (r *RecordedResponse) toResponse(req *http.Request) (*http.Response, error) {
+	body := []byte(r.Body)
+	if r.Base64 {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(r.Body); err != nil {
+			return nil, fmt.Errorf("failed to decode recorded body: %w", err)
+		}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.Headers.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func encodeBody(body string) (string, bool) {
+	if utf8.ValidString(body) {
+		return body, false
+	}
+	return base64.StdEncoding.EncodeToString([]byte(body)), true
+}
+
+// equalBodies compares two bodies, ignoring formatting differences if both are JSON.
+func equalBodies(a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	var compactA, compactB bytes.Buffer
+	if json.Compact(&compactA, []byte(a)) != nil || json.Compact(&compactB, []byte(b)) != nil {
+		return false
+	}
+	return compactA.String() == compactB.String()
+}
@@ -0,0 +1,152 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorderRoundTripper(t *testing.T) {
+	tests := []struct {
+		name              string
+		mode              RecorderMode
+		method            string
+		url               string
+		body              string
+		expectedBody      string
+		expectedErr       error
+		expectedNextCalls int
+	}{
+		{
+			name:         "Replay matching request",
+			mode:         ModeReplay,
+			method:       http.MethodGet,
+			url:          "http://example.com/users?page=1",
+			expectedBody: "GET /users ",
+		},
+		{
+			name:         "Replay JSON body ignoring formatting",
+			mode:         ModeReplay,
+			method:       http.MethodPost,
+			url:          "http://example.com/users",
+			body:         `{ "name": "alice" }`,
+			expectedBody: `POST /users {"name":"alice"}`,
+		},
+		{
+			name:        "Fail on different query in replay",
+			mode:        ModeReplay,
+			method:      http.MethodGet,
+			url:         "http://example.com/users?page=2",
+			expectedErr: ErrInteractionNotFound,
+		},
+		{
+			name:        "Fail on different body in replay",
+			mode:        ModeReplay,
+			method:      http.MethodPost,
+			url:         "http://example.com/users",
+			body:        `{"name":"bob"}`,
+			expectedErr: ErrInteractionNotFound,
+		},
+		{
+			name:              "Record unmatched request in replay or record",
+			mode:              ModeReplayOrRecord,
+			method:            http.MethodGet,
+			url:               "http://example.com/orders",
+			expectedBody:      "GET /orders ",
+			expectedNextCalls: 1,
+		},
+		{
+			name:              "Send every request in record",
+			mode:              ModeRecord,
+			method:            http.MethodGet,
+			url:               "http://example.com/users?page=1",
+			expectedBody:      "GET /users ",
+			expectedNextCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nextCalls int
+			next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				nextCalls++
+				body, _ := io.ReadAll(req.Body)
+				return newResponse(req, http.StatusOK, req.Method+" "+req.URL.Path+" "+string(body)), nil
+			})
+
+			cassettePath := filepath.Join(t.TempDir(), "cassette.json")
+			recordInteractions(t, cassettePath, next)
+			nextCalls = 0
+
+			recorder, err := NewRecorderRoundTripper(DefaultRecorderConfig(cassettePath, tt.mode), next)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			resp, err := recorder.RoundTrip(httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error %v, got %v", tt.expectedErr, err)
+			}
+			if nextCalls != tt.expectedNextCalls {
+				t.Errorf("expected %d requests sent, got %d", tt.expectedNextCalls, nextCalls)
+			}
+			if err != nil {
+				return
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, string(body))
+			}
+		})
+	}
+}
+
+func TestRecorderRoundTripperRedaction(t *testing.T) {
+	next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp := newResponse(req, http.StatusOK, "")
+		resp.Header.Set("Set-Cookie", "session=secret-cookie")
+		return resp, nil
+	})
+
+	cassettePath := filepath.Join(t.TempDir(), "cassette.json")
+	recordInteractions(t, cassettePath, next)
+
+	data, err := os.ReadFile(cassettePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, secret := range []string{"secret-token", "secret-cookie"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("expected %s to be redacted from cassette, got %s", secret, string(data))
+		}
+	}
+}
+
+// recordInteractions records a GET and a POST with credentials to cassettePath.
+func recordInteractions(t *testing.T, cassettePath string, next http.RoundTripper) {
+	t.Helper()
+
+	recorder, err := NewRecorderRoundTripper(DefaultRecorderConfig(cassettePath, ModeRecord), next)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodGet, "http://example.com/users?page=1", nil),
+		httptest.NewRequest(http.MethodPost, "http://example.com/users", strings.NewReader(`{"name":"alice"}`)),
+	}
+	for _, req := range requests {
+		req.Header.Set("Authorization", "Bearer secret-token")
+		resp, err := recorder.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error recording: %v", err)
+		}
+		_ = resp.Body.Close()
+	}
+}
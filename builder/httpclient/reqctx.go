@@ -0,0 +1,102 @@
+package httpclient
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/raythx98/gohelpme/builder/httprequest"
+	"github.com/raythx98/gohelpme/tool/reqctx"
+)
+
+// PropagationConfig is the configuration for the PropagateRoundTripper.
+type PropagationConfig struct {
+	// Headers maps outbound header names to functions extracting their values from reqctx.Value.
+	// Empty values are not sent.
+	Headers map[string]func(v *reqctx.Value) string
+}
+
+// DefaultPropagationConfig returns a PropagationConfig that forwards only the request ID.
+//
+// The inbound idempotency key is deliberately not forwarded: two outbound mutations sharing it would be deduplicated
+// by the downstream service, so IdempotencyKey derives a key per call from it instead.
+// Add IdempotencyKeyValue to Headers to forward it as is.
+func DefaultPropagationConfig() PropagationConfig {
+	return PropagationConfig{
+		Headers: map[string]func(v *reqctx.Value) string{
+			string(httprequest.RequestId): RequestIdValue,
+		},
+	}
+}
+
+// RequestIdValue extracts the request ID from reqctx.Value.
+func RequestIdValue(v *reqctx.Value) string {
+	return v.RequestId
+}
+
+// IdempotencyKeyValue extracts the idempotency key from reqctx.Value.
+func IdempotencyKeyValue(v *reqctx.Value) string {
+	if v.IdempotencyKey == nil {
+		return ""
+	}
+	return *v.IdempotencyKey
+}
+
+// UserIdValue extracts the user ID from reqctx.Value.
+func UserIdValue(v *reqctx.Value) string {
+	if v.UserId == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v.UserId, 10)
+}
+
+// PropagateRoundTripper is an http.RoundTripper that forwards reqctx values of the originating request as headers,
+// so that downstream calls can be correlated back to it.
+type PropagateRoundTripper struct {
+	cfg  PropagationConfig
+	next http.RoundTripper
+}
+
+// NewPropagateRoundTripper creates a new PropagateRoundTripper that sends requests through next.
+//
+// If next is nil, http.DefaultTransport is used.
+func NewPropagateRoundTripper(cfg PropagationConfig, next http.RoundTripper) *PropagateRoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &PropagateRoundTripper{cfg: cfg, next: next}
+}
+
+// Propagate is a Middleware that forwards reqctx values as headers to the next http.RoundTripper.
+func Propagate(cfg PropagationConfig) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewPropagateRoundTripper(cfg, next)
+	}
+}
+
+// RoundTrip executes a single HTTP transaction, adding the configured headers that are not already set on the request.
+func (t *PropagateRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	value := reqctx.GetValue(req.Context())
+	if value == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	headers := make(map[string]string)
+	for key, extract := range t.cfg.Headers {
+		if req.Header.Get(key) != "" {
+			continue
+		}
+		if headerValue := extract(value); headerValue != "" {
+			headers[key] = headerValue
+		}
+	}
+	if len(headers) == 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the original request
+	propagatedReq := req.Clone(req.Context())
+	for key, headerValue := range headers {
+		propagatedReq.Header.Set(key, headerValue)
+	}
+	return t.next.RoundTrip(propagatedReq)
+}
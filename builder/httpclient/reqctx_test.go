@@ -0,0 +1,93 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/raythx98/gohelpme/tool/reqctx"
+)
+
+func TestPropagateRoundTripper(t *testing.T) {
+	tests := []struct {
+		name            string
+		cfg             PropagationConfig
+		value           *reqctx.Value
+		headers         map[string]string
+		expectedHeaders map[string]string
+	}{
+		{
+			name:            "Forward request ID",
+			cfg:             DefaultPropagationConfig(),
+			value:           reqctx.New("request-id"),
+			expectedHeaders: map[string]string{"X-Request-ID": "request-id"},
+		},
+		{
+			name:            "Do not forward idempotency key by default",
+			cfg:             DefaultPropagationConfig(),
+			value:           reqctx.New("request-id").SetIdempotencyKey("inbound-key"),
+			expectedHeaders: map[string]string{"X-Request-ID": "request-id", "Idempotency-Key": ""},
+		},
+		{
+			name: "Forward configured extras",
+			cfg: PropagationConfig{Headers: map[string]func(v *reqctx.Value) string{
+				"X-User-ID": UserIdValue,
+			}},
+			value:           reqctx.New("request-id").SetUserId(42),
+			expectedHeaders: map[string]string{"X-User-ID": "42", "X-Request-ID": ""},
+		},
+		{
+			name:            "Keep header already set on the request",
+			cfg:             DefaultPropagationConfig(),
+			value:           reqctx.New("request-id"),
+			headers:         map[string]string{"X-Request-ID": "explicit-id"},
+			expectedHeaders: map[string]string{"X-Request-ID": "explicit-id"},
+		},
+		{
+			name: "Skip empty values",
+			cfg: PropagationConfig{Headers: map[string]func(v *reqctx.Value) string{
+				"X-User-ID": UserIdValue,
+			}},
+			value:           reqctx.New("request-id"),
+			expectedHeaders: map[string]string{"X-User-ID": ""},
+		},
+		{
+			name:            "Pass through without request context",
+			cfg:             DefaultPropagationConfig(),
+			expectedHeaders: map[string]string{"X-Request-ID": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent *http.Request
+			next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				sent = req
+				return newResponse(req, http.StatusOK, ""), nil
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.com", nil)
+			if tt.value != nil {
+				req = req.WithContext(context.WithValue(req.Context(), reqctx.Key, tt.value))
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			originalHeaders := req.Header.Clone()
+
+			if _, err := NewPropagateRoundTripper(tt.cfg, next).RoundTrip(req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for k, v := range tt.expectedHeaders {
+				if got := sent.Header.Get(k); got != v {
+					t.Errorf("expected header %s %q, got %q", k, v, got)
+				}
+			}
+			if len(req.Header) != len(originalHeaders) {
+				t.Errorf("expected original request headers to be unchanged, got %v", req.Header)
+			}
+		})
+	}
+}
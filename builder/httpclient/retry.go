@@ -0,0 +1,217 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/raythx98/gohelpme/builder/httprequest"
+)
+
+// RetryConfig is the configuration for the RetryRoundTripper.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts, 0 for no cap.
+	// A Retry-After longer than MaxBackoff is not waited for, and the response is returned as is.
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after every attempt.
+	Multiplier float64
+	// Jitter randomizes every backoff by up to the given fraction, e.g. 0.2 for ±20%, still capped by MaxBackoff.
+	Jitter float64
+	// RetryableStatusCodes are the response status codes that are retried.
+	RetryableStatusCodes []int
+	// RetryNonIdempotent allows retrying non-idempotent methods such as POST.
+	//
+	// Requests carrying an Idempotency-Key header are always considered idempotent.
+	RetryNonIdempotent bool
+	// RetryableError reports whether a transport error is retried, defaults to IsRetryableError.
+	RetryableError func(err error) bool
+}
+
+// DefaultRetryConfig returns a RetryConfig with sensible defaults.
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableStatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		RetryableError: IsRetryableError,
+	}
+}
+
+// RetryRoundTripper is an http.RoundTripper that retries failed requests with exponential backoff.
+type RetryRoundTripper struct {
+	cfg  RetryConfig
+	next http.RoundTripper
+}
+
+// NewRetryRoundTripper creates a new RetryRoundTripper that sends requests through next.
+//
+// If next is nil, http.DefaultTransport is used.
+// It can be stacked with the LogRoundTripper to log every attempt:
+//
+//	httpClient := &http.Client{
+//		Transport: httpclient.NewRetryRoundTripper(httpclient.DefaultRetryConfig(), httpclient.NewLogRoundTripper(log)),
+//	}
+func NewRetryRoundTripper(cfg RetryConfig, next http.RoundTripper) *RetryRoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if cfg.RetryableError == nil {
+		cfg.RetryableError = IsRetryableError
+	}
+	return &RetryRoundTripper{cfg: cfg, next: next}
+}
+
+// Retry is a Middleware that retries requests sent through the next http.RoundTripper.
+func Retry(cfg RetryConfig) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewRetryRoundTripper(cfg, next)
+	}
+}
+
+// RoundTrip executes a single HTTP transaction, retrying it according to the RetryConfig.
+func (t *RetryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.cfg.MaxAttempts <= 1 || !t.isRetryableRequest(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	getBody := rewindBody(req)
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if attempt > 1 {
+			var err error
+			if attemptReq, err = cloneRequest(req, getBody); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := t.next.RoundTrip(attemptReq)
+		if attempt >= t.cfg.MaxAttempts || !t.isRetryableResult(resp, err) {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt)
+		if retryAfter, ok := parseRetryAfter(resp); ok {
+			if t.cfg.MaxBackoff > 0 && retryAfter > t.cfg.MaxBackoff {
+				return resp, err
+			}
+			wait = retryAfter
+		}
+
+		drainBody(resp)
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *RetryRoundTripper) isRetryableRequest(req *http.Request) bool {
+	return t.cfg.RetryNonIdempotent ||
+		httprequest.Method(req.Method).IsIdempotent() ||
+		req.Header.Get(string(httprequest.IdempotencyKey)) != ""
+}
+
+func (t *RetryRoundTripper) isRetryableResult(resp *http.Response, err error) bool {
+	if err != nil {
+		return t.cfg.RetryableError(err)
+	}
+	return resp != nil && slices.Contains(t.cfg.RetryableStatusCodes, resp.StatusCode)
+}
+
+// backoff returns the delay after the given attempt, with jitter applied.
+func (t *RetryRoundTripper) backoff(attempt int) time.Duration {
+	multiplier := t.cfg.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(t.cfg.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if t.cfg.Jitter > 0 {
+		backoff *= 1 + t.cfg.Jitter*(2*rand.Float64()-1)
+	}
+	// Cap after jitter, so that MaxBackoff holds for every delay
+	if t.cfg.MaxBackoff > 0 && backoff > float64(t.cfg.MaxBackoff) {
+		backoff = float64(t.cfg.MaxBackoff)
+	}
+	return time.Duration(backoff)
+}
+
+// IsRetryableError reports whether a transport error is likely transient, such as a connection reset or timeout.
+//
+// Errors caused by the request context being cancelled or timing out are never retryable.
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// parseRetryAfter parses the Retry-After header, which is either delay-seconds or an HTTP-date.
+func parseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+// sleep waits for d, returning early with the context error if ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,161 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryRoundTripper(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		body             string
+		headers          map[string]string
+		statuses         []int
+		retryAfter       string
+		uncappedBackoff  bool
+		expectedStatus   int
+		expectedAttempts int32
+	}{
+		{
+			name:             "Retry GET until success",
+			method:           http.MethodGet,
+			statuses:         []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			expectedStatus:   http.StatusOK,
+			expectedAttempts: 3,
+		},
+		{
+			name:             "Stop after max attempts",
+			method:           http.MethodGet,
+			statuses:         []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			expectedStatus:   http.StatusServiceUnavailable,
+			expectedAttempts: 3,
+		},
+		{
+			name:             "Do not retry non-retryable status",
+			method:           http.MethodGet,
+			statuses:         []int{http.StatusBadRequest, http.StatusOK},
+			expectedStatus:   http.StatusBadRequest,
+			expectedAttempts: 1,
+		},
+		{
+			name:             "Do not retry POST",
+			method:           http.MethodPost,
+			body:             `{"amount":1}`,
+			statuses:         []int{http.StatusServiceUnavailable, http.StatusOK},
+			expectedStatus:   http.StatusServiceUnavailable,
+			expectedAttempts: 1,
+		},
+		{
+			name:             "Retry POST with idempotency key and replay body",
+			method:           http.MethodPost,
+			body:             `{"amount":1}`,
+			headers:          map[string]string{"Idempotency-Key": "key"},
+			statuses:         []int{http.StatusServiceUnavailable, http.StatusOK},
+			expectedStatus:   http.StatusOK,
+			expectedAttempts: 2,
+		},
+		{
+			name:             "Do not wait for Retry-After beyond max backoff",
+			method:           http.MethodGet,
+			statuses:         []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:       "120",
+			expectedStatus:   http.StatusTooManyRequests,
+			expectedAttempts: 1,
+		},
+		{
+			name:             "Honor Retry-After within max backoff",
+			method:           http.MethodGet,
+			statuses:         []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:       "0",
+			expectedStatus:   http.StatusOK,
+			expectedAttempts: 2,
+		},
+		{
+			name:             "Honor Retry-After without max backoff",
+			method:           http.MethodGet,
+			statuses:         []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:       "1",
+			uncappedBackoff:  true,
+			expectedStatus:   http.StatusOK,
+			expectedAttempts: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := attempts.Add(1)
+				if body, _ := io.ReadAll(r.Body); string(body) != tt.body {
+					t.Errorf("attempt %d body = %q, want %q", attempt, string(body), tt.body)
+				}
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.statuses[attempt-1])
+			}))
+			defer server.Close()
+
+			cfg := DefaultRetryConfig()
+			cfg.InitialBackoff = time.Millisecond
+			cfg.MaxBackoff = 10 * time.Millisecond
+			if tt.uncappedBackoff {
+				cfg.MaxBackoff = 0
+			}
+			client := &http.Client{Transport: NewRetryRoundTripper(cfg, nil)}
+
+			req, _ := http.NewRequest(tt.method, server.URL, io.NopCloser(strings.NewReader(tt.body)))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.expectedStatus)
+			}
+			if got := attempts.Load(); got != tt.expectedAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.expectedAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryRoundTripperBackoff(t *testing.T) {
+	tests := []struct {
+		name        string
+		attempt     int
+		minExpected time.Duration
+		maxExpected time.Duration
+	}{
+		{name: "Jitter first backoff", attempt: 1, minExpected: 50 * time.Millisecond, maxExpected: 150 * time.Millisecond},
+		{name: "Jitter multiplied backoff", attempt: 2, minExpected: 100 * time.Millisecond, maxExpected: 300 * time.Millisecond},
+		{name: "Cap jittered backoff at MaxBackoff", attempt: 10, minExpected: 500 * time.Millisecond, maxExpected: time.Second},
+	}
+
+	transport := NewRetryRoundTripper(RetryConfig{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := transport.backoff(tt.attempt); got < tt.minExpected || got > tt.maxExpected {
+					t.Fatalf("backoff = %v, want between %v and %v", got, tt.minExpected, tt.maxExpected)
+				}
+			}
+		})
+	}
+}
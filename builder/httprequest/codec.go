@@ -0,0 +1,152 @@
+package httprequest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ErrNoCodec is returned when no Codec is registered for a content type.
+var ErrNoCodec = errors.New("no codec registered for content type")
+
+// Codec encodes and decodes bodies of a content type.
+type Codec interface {
+	// ContentType is the media type the Codec is registered for, e.g. "application/json".
+	ContentType() ContentType
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		string(ApplicationJson):           JsonCodec{},
+		string(ApplicationXml):            XmlCodec{},
+		string(ApplicationFormUrlEncoded): FormCodec{},
+	}
+)
+
+// RegisterCodec registers the codec for its content type, replacing any existing one, e.g. for protobuf:
+//
+//	httprequest.RegisterCodec(ProtobufCodec{})
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[mediaType(string(codec.ContentType()))] = codec
+}
+
+// GetCodec returns the Codec registered for the media type of contentType, ignoring its parameters such as charset.
+//
+// Structured syntax suffixes fall back to their base codec, e.g. "application/problem+json" uses the JSON codec,
+// and "text/xml" uses the XML codec.
+func GetCodec(contentType string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	media := mediaType(contentType)
+	if codec, ok := codecs[media]; ok {
+		return codec, true
+	}
+
+	switch {
+	case strings.HasSuffix(media, "+json"):
+		media = string(ApplicationJson)
+	case strings.HasSuffix(media, "+xml"), media == "text/xml":
+		media = string(ApplicationXml)
+	}
+	codec, ok := codecs[media]
+	return codec, ok
+}
+
+func mediaType(contentType string) string {
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return media
+}
+
+// JsonCodec is the Codec for `application/json`, used by default.
+type JsonCodec struct{}
+
+func (JsonCodec) ContentType() ContentType {
+	return ApplicationJson
+}
+
+func (JsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// XmlCodec is the Codec for `application/xml` and `text/xml`.
+type XmlCodec struct{}
+
+func (XmlCodec) ContentType() ContentType {
+	return ApplicationXml
+}
+
+func (XmlCodec) Marshal(v any) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+func (XmlCodec) Unmarshal(data []byte, v any) error {
+	return xml.Unmarshal(data, v)
+}
+
+// FormCodec is the Codec for `application/x-www-form-urlencoded`.
+//
+// It marshals url.Values, map[string]string, or structs with `url` tags as described by Builder.WithQueryStruct,
+// and unmarshals into *url.Values or *map[string]string.
+type FormCodec struct{}
+
+func (FormCodec) ContentType() ContentType {
+	return ApplicationFormUrlEncoded
+}
+
+func (FormCodec) Marshal(v any) ([]byte, error) {
+	switch form := v.(type) {
+	case url.Values:
+		return []byte(form.Encode()), nil
+	case map[string]string:
+		values := url.Values{}
+		for k, v := range form {
+			values.Set(k, v)
+		}
+		return []byte(values.Encode()), nil
+	default:
+		values, err := encodeQuery(v)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(values.Encode()), nil
+	}
+}
+
+func (FormCodec) Unmarshal(data []byte, v any) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+
+	switch form := v.(type) {
+	case *url.Values:
+		*form = values
+	case *map[string]string:
+		*form = make(map[string]string, len(values))
+		for k := range values {
+			(*form)[k] = values.Get(k)
+		}
+	default:
+		return fmt.Errorf("cannot unmarshal form into %T", v)
+	}
+	return nil
+}
@@ -6,12 +6,17 @@ const (
 	RequestId      HeaderKey = "X-Request-ID"
 	ContentTypeKey HeaderKey = "Content-Type"
 	Authorization  HeaderKey = "Authorization"
+	IdempotencyKey HeaderKey = "Idempotency-Key"
 )
 
 type ContentType string
 
 const (
-	ApplicationJson ContentType = "application/json"
+	ApplicationJson           ContentType = "application/json"
+	ApplicationFormUrlEncoded ContentType = "application/x-www-form-urlencoded"
+	ApplicationXml            ContentType = "application/xml"
+	ApplicationOctetStream    ContentType = "application/octet-stream"
+	MultipartFormData         ContentType = "multipart/form-data"
 )
 
 type Method string
@@ -22,7 +27,19 @@ const (
 	Head    Method = "HEAD"
 	Post    Method = "POST"
 	Put     Method = "PUT"
+	Patch   Method = "PATCH"
 	Delete  Method = "DELETE"
 	Trace   Method = "TRACE"
 	Connect Method = "CONNECT"
 )
+
+// IsIdempotent reports whether the method is idempotent as defined by RFC 9110,
+// i.e. sending the same request multiple times has the same effect as sending it once.
+func (m Method) IsIdempotent() bool {
+	switch m {
+	case Options, Get, Head, Put, Delete, Trace:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,60 @@
+package httprequest
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/raythx98/gohelpme/tool/httphelper"
+	"github.com/raythx98/gohelpme/tool/redactor"
+)
+
+// ToCurl renders the request as an equivalent curl command, with every argument shell-escaped.
+//
+// The values of redactedHeaders, matched case-insensitively, are replaced by redactor.RedactedValue.
+// The request body is read and set back to its original state, as with httphelper.PeekRequestBody.
+func ToCurl(req *http.Request, redactedHeaders ...string) string {
+	args := []string{"curl"}
+
+	body := ""
+	if req.Body != nil && req.Body != http.NoBody {
+		body, _ = httphelper.PeekRequestBody(req, 0)
+	}
+	switch {
+	case req.Method == http.MethodHead:
+		// -X HEAD makes curl wait for a response body that never comes
+		args = append(args, "-I")
+	case req.Method != http.MethodGet || body != "":
+		args = append(args, "-X", shellEscape(req.Method))
+	}
+	args = append(args, shellEscape(req.URL.String()))
+
+	for _, name := range slices.Sorted(maps.Keys(req.Header)) {
+		redacted := slices.ContainsFunc(redactedHeaders, func(redactedHeader string) bool {
+			return strings.EqualFold(redactedHeader, name)
+		})
+		for _, value := range req.Header[name] {
+			if redacted {
+				value = redactor.RedactedValue
+			}
+			args = append(args, "-H", shellEscape(fmt.Sprintf("%s: %s", name, value)))
+		}
+	}
+
+	if req.Host != "" && req.Host != req.URL.Host {
+		args = append(args, "-H", shellEscape(fmt.Sprintf("Host: %s", req.Host)))
+	}
+
+	if body != "" {
+		args = append(args, "--data-binary", shellEscape(body))
+	}
+
+	return strings.Join(args, " ")
+}
+
+// shellEscape quotes s for POSIX shells, so that it is passed as a single argument without expansion.
+func shellEscape(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,132 @@
+package httprequest
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// encodeQuery encodes the fields of the struct v into query values, as described by Builder.WithQueryStruct.
+func encodeQuery(v any) (url.Values, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return url.Values{}, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("query must be a struct, got %s", rv.Kind())
+	}
+
+	values := url.Values{}
+	if err := encodeStruct(values, rv); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func encodeStruct(values url.Values, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("url")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		omitEmpty := opts == "omitempty"
+
+		// Fields of embedded structs are promoted, even if the embedded struct itself is unexported
+		fv := rv.Field(i)
+		if field.Anonymous && name == "" && (field.Type.Kind() == reflect.Struct || field.IsExported()) {
+			if fv = indirect(fv); fv.Kind() == reflect.Struct {
+				if err := encodeStruct(values, fv); err != nil {
+					return err
+				}
+				continue
+			}
+			fv = rv.Field(i)
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if fv.Kind() == reflect.Pointer && fv.IsNil() {
+			continue
+		}
+		fv = indirect(fv)
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+
+		if fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array {
+			for j := 0; j < fv.Len(); j++ {
+				s, err := formatValue(indirect(fv.Index(j)))
+				if err != nil {
+					return fmt.Errorf("failed to encode query %s: %w", name, err)
+				}
+				values.Add(name, s)
+			}
+			continue
+		}
+
+		s, err := formatValue(fv)
+		if err != nil {
+			return fmt.Errorf("failed to encode query %s: %w", name, err)
+		}
+		values.Add(name, s)
+	}
+	return nil
+}
+
+func indirect(rv reflect.Value) reflect.Value {
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+// formatValue formats a query value, using time.RFC3339 for times and the encoding.TextMarshaler or fmt.Stringer of other types.
+func formatValue(rv reflect.Value) (string, error) {
+	if !rv.IsValid() {
+		return "", nil
+	}
+
+	if rv.CanInterface() {
+		switch v := rv.Interface().(type) {
+		case time.Time:
+			return v.Format(time.RFC3339), nil
+		case encoding.TextMarshaler:
+			text, err := v.MarshalText()
+			return string(text), err
+		case fmt.Stringer:
+			return v.String(), nil
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, rv.Type().Bits()), nil
+	default:
+		return "", fmt.Errorf("unsupported type %s", rv.Type())
+	}
+}
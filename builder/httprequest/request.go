@@ -3,14 +3,32 @@ package httprequest
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type Builder struct {
 	HttpRequest *http.Request
 	Error       error
+
+	cancel  context.CancelFunc
+	timeout time.Duration
+	// pathTemplate and rawPathTemplate are the url path before any path params are substituted.
+	pathTemplate    string
+	rawPathTemplate string
+	pathParams      map[string]string
 }
 
 // New creates a new http request with the given method and url.
@@ -19,21 +37,259 @@ func (i *Builder) New(ctx context.Context, method Method, url string) *Builder {
 	return &Builder{HttpRequest: req, Error: err}
 }
 
-// WithBody sets the request body.
+// WithBody sets the request body, encoded by the Codec of the `Content-Type` set with WithContentType or WithHeaders.
+//
+// The body is encoded as JSON if no `Content-Type` is set, and an ErrNoCodec is set if no Codec is registered for it.
 func (i *Builder) WithBody(body any) *Builder {
 	if i.Error != nil || body == nil {
 		return i
 	}
 
-	var reqBody []byte
-	var err error
-	if reqBody, err = json.Marshal(body); err != nil {
+	contentType := i.HttpRequest.Header.Get(string(ContentTypeKey))
+	if contentType == "" {
+		contentType = string(ApplicationJson)
+	}
+
+	codec, ok := GetCodec(contentType)
+	if !ok {
+		i.Error = fmt.Errorf("%w: %s", ErrNoCodec, contentType)
+		return i
+	}
+
+	reqBody, err := codec.Marshal(body)
+	if err != nil {
 		i.Error = err
 		return i
 	}
 
-	i.HttpRequest.Body = io.NopCloser(bytes.NewBuffer(reqBody))
-	i.HttpRequest.Header.Set(string(ContentTypeKey), string(ApplicationJson))
+	i.setBody(reqBody, ContentType(contentType))
+	return i
+}
+
+// WithContentType sets the request `Content-Type` header, which selects the Codec used by WithBody.
+func (i *Builder) WithContentType(contentType ContentType) *Builder {
+	if i.Error != nil {
+		return i
+	}
+	i.HttpRequest.Header.Set(string(ContentTypeKey), string(contentType))
+	return i
+}
+
+// WithFormBody sets the request body to the url-encoded form.
+func (i *Builder) WithFormBody(form url.Values) *Builder {
+	if i.Error != nil || form == nil {
+		return i
+	}
+
+	i.setBody([]byte(form.Encode()), ApplicationFormUrlEncoded)
+	return i
+}
+
+// MultipartFile is a file part of a multipart/form-data body.
+type MultipartFile struct {
+	FieldName string
+	FileName  string
+	// ContentType defaults to `application/octet-stream`.
+	ContentType ContentType
+	Reader      io.Reader
+}
+
+// WithMultipartBody sets the request body to a multipart/form-data payload of the fields and files.
+//
+// The payload is buffered in memory, so that it can be re-read on retries and redirects.
+func (i *Builder) WithMultipartBody(fields map[string]string, files ...MultipartFile) *Builder {
+	if i.Error != nil {
+		return i
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		if err := writer.WriteField(name, fields[name]); err != nil {
+			i.Error = fmt.Errorf("failed to write multipart field %s: %w", name, err)
+			return i
+		}
+	}
+
+	for _, file := range files {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = ApplicationOctetStream
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+			"name":     file.FieldName,
+			"filename": file.FileName,
+		}))
+		header.Set(string(ContentTypeKey), string(contentType))
+
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			i.Error = fmt.Errorf("failed to write multipart file %s: %w", file.FieldName, err)
+			return i
+		}
+		if _, err := io.Copy(part, file.Reader); err != nil {
+			i.Error = fmt.Errorf("failed to write multipart file %s: %w", file.FieldName, err)
+			return i
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		i.Error = fmt.Errorf("failed to write multipart body: %w", err)
+		return i
+	}
+
+	i.setBody(buf.Bytes(), ContentType(writer.FormDataContentType()))
+	return i
+}
+
+// WithReaderBody streams the request body from r, with a contentLength of -1 if unknown.
+//
+// If r is an io.ReaderAt and io.Seeker, such as an *os.File, the body can be rewound on retries and by the logging
+// transport. Every rewound body reads r independently from its current offset, so that hedged requests do not
+// interfere, and r is not closed by the client.
+func (i *Builder) WithReaderBody(r io.Reader, contentLength int64, contentType ContentType) *Builder {
+	if i.Error != nil || r == nil {
+		return i
+	}
+
+	body, ok := r.(io.ReadCloser)
+	if !ok {
+		body = io.NopCloser(r)
+	}
+	i.HttpRequest.Body = body
+	i.HttpRequest.ContentLength = contentLength
+	i.HttpRequest.GetBody = nil
+
+	if readerAt, ok := r.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		offset, err := readerAt.Seek(0, io.SeekCurrent)
+		if err != nil {
+			i.Error = fmt.Errorf("failed to seek body: %w", err)
+			return i
+		}
+		size := contentLength
+		if size < 0 {
+			end, err := readerAt.Seek(0, io.SeekEnd)
+			if err != nil {
+				i.Error = fmt.Errorf("failed to seek body: %w", err)
+				return i
+			}
+			if _, err := readerAt.Seek(offset, io.SeekStart); err != nil {
+				i.Error = fmt.Errorf("failed to seek body: %w", err)
+				return i
+			}
+			size = end - offset
+		}
+
+		i.HttpRequest.Body = io.NopCloser(io.NewSectionReader(readerAt, offset, size))
+		i.HttpRequest.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(io.NewSectionReader(readerAt, offset, size)), nil
+		}
+	}
+
+	if contentLength == 0 {
+		// A zero ContentLength with a non-nil Body is treated as unknown by http.Client
+		i.HttpRequest.Body = http.NoBody
+		i.HttpRequest.GetBody = nil
+	}
+	if contentType != "" {
+		i.HttpRequest.Header.Set(string(ContentTypeKey), string(contentType))
+	}
+	return i
+}
+
+// setBody sets the request body and its `Content-Type`, allowing it to be re-read on retries and redirects.
+func (i *Builder) setBody(body []byte, contentType ContentType) {
+	i.HttpRequest.Body = io.NopCloser(bytes.NewReader(body))
+	i.HttpRequest.ContentLength = int64(len(body))
+	i.HttpRequest.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	i.HttpRequest.Header.Set(string(ContentTypeKey), string(contentType))
+}
+
+// WithQuery adds the query parameters to the request url, keeping the ones already in it.
+func (i *Builder) WithQuery(params map[string]string) *Builder {
+	if i.Error != nil || len(params) == 0 {
+		return i
+	}
+
+	query := i.HttpRequest.URL.Query()
+	for k, v := range params {
+		query.Add(k, v)
+	}
+	i.HttpRequest.URL.RawQuery = query.Encode()
+	return i
+}
+
+// WithQueryStruct adds the fields of the struct v to the request url as query parameters, keeping the ones already in it.
+//
+// Fields are named by their `url` tag, e.g. `url:"page_size,omitempty"`, and skipped with `url:"-"`.
+// Slices add one parameter per element, and nil pointers are skipped.
+func (i *Builder) WithQueryStruct(v any) *Builder {
+	if i.Error != nil || v == nil {
+		return i
+	}
+
+	values, err := encodeQuery(v)
+	if err != nil {
+		i.Error = err
+		return i
+	}
+
+	query := i.HttpRequest.URL.Query()
+	for k, vs := range values {
+		query[k] = append(query[k], vs...)
+	}
+	i.HttpRequest.URL.RawQuery = query.Encode()
+	return i
+}
+
+// WithPathParam replaces the `{name}` placeholder in the request url path with the escaped value,
+// e.g. "/users/{id}" with id "a/b" becomes "/users/a%2Fb".
+func (i *Builder) WithPathParam(name, value string) *Builder {
+	return i.WithPathParams(map[string]string{name: value})
+}
+
+// WithPathParams replaces the `{name}` placeholders in the request url path with the escaped values.
+//
+// Placeholders are substituted in a single pass over the original path, so a value holding another placeholder
+// is kept as is. Values of "." and ".." are rejected, as they would change the path once resolved.
+func (i *Builder) WithPathParams(params map[string]string) *Builder {
+	if i.Error != nil {
+		return i
+	}
+
+	u := i.HttpRequest.URL
+	if i.pathParams == nil {
+		i.pathTemplate, i.rawPathTemplate = u.Path, u.EscapedPath()
+		i.pathParams = make(map[string]string)
+	}
+	for name, value := range params {
+		if !strings.Contains(i.pathTemplate, "{"+name+"}") {
+			i.Error = fmt.Errorf("path param %s not found in %s", name, i.pathTemplate)
+			return i
+		}
+		if value == "." || value == ".." {
+			i.Error = fmt.Errorf("path param %s must not be %q", name, value)
+			return i
+		}
+		i.pathParams[name] = value
+	}
+
+	// EscapedPath always escapes the braces of placeholders, so the escaped values can be substituted safely
+	var replacements, rawReplacements []string
+	for name, value := range i.pathParams {
+		replacements = append(replacements, "{"+name+"}", value)
+		rawReplacements = append(rawReplacements, "%7B"+url.PathEscape(name)+"%7D", url.PathEscape(value))
+	}
+	u.Path = strings.NewReplacer(replacements...).Replace(i.pathTemplate)
+	u.RawPath = strings.NewReplacer(rawReplacements...).Replace(i.rawPathTemplate)
 	return i
 }
 
@@ -46,6 +302,20 @@ func (i *Builder) WithAuth(auth string) *Builder {
 	return i
 }
 
+// WithIdempotencyKey sets the request `Idempotency-Key` header, generating a random key if key is empty.
+//
+// The key is kept by the request, so that retries of it are deduplicated by the server.
+func (i *Builder) WithIdempotencyKey(key string) *Builder {
+	if i.Error != nil {
+		return i
+	}
+	if key == "" {
+		key = uuid.NewString()
+	}
+	i.HttpRequest.Header.Set(string(IdempotencyKey), key)
+	return i
+}
+
 // WithHeaders sets the request headers.
 func (i *Builder) WithHeaders(headers map[string]string) *Builder {
 	if i.Error != nil {
@@ -57,7 +327,77 @@ func (i *Builder) WithHeaders(headers map[string]string) *Builder {
 	return i
 }
 
-// Build returns the http request and error.
+// WithTimeout bounds the request with a timeout, replacing any timeout set before,
+// which must be released with Cancel once the response is done with.
+//
+// The timeout starts when Build is called, just before the request is sent, so it does not count the time spent
+// building the request.
+func (i *Builder) WithTimeout(timeout time.Duration) *Builder {
+	if i.Error != nil {
+		return i
+	}
+	i.timeout = timeout
+	return i
+}
+
+// Cancel releases the timeout set with WithTimeout, cancelling the request if it is still in flight.
+func (i *Builder) Cancel() {
+	if i.cancel != nil {
+		i.cancel()
+	}
+}
+
+// Clone returns an independent copy of the builder, with deep-copied url and headers, and a rewound body.
+//
+// A body that cannot be rewound, as it has no GetBody, cannot be cloned and sets the Error of the copy.
+// A timeout set with WithTimeout is started by the Build of the copy and released by its Cancel,
+// unless the original was already built, in which case the copy shares its context.
+func (i *Builder) Clone() *Builder {
+	if i.HttpRequest == nil {
+		return &Builder{Error: i.Error}
+	}
+
+	req := i.HttpRequest.Clone(i.HttpRequest.Context())
+	clone := &Builder{
+		HttpRequest:     req,
+		Error:           i.Error,
+		timeout:         i.timeout,
+		pathTemplate:    i.pathTemplate,
+		rawPathTemplate: i.rawPathTemplate,
+		pathParams:      maps.Clone(i.pathParams),
+	}
+	if clone.Error != nil || req.Body == nil || req.Body == http.NoBody {
+		return clone
+	}
+
+	if req.GetBody == nil {
+		clone.Error = errors.New("failed to clone body: body cannot be rewound")
+		return clone
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		clone.Error = fmt.Errorf("failed to clone body: %w", err)
+		return clone
+	}
+	req.Body = body
+	return clone
+}
+
+// Build returns the http request and error, starting the timeout set with WithTimeout.
 func (i *Builder) Build() (*http.Request, error) {
+	if i.Error == nil && i.timeout > 0 {
+		ctx, cancel := context.WithTimeout(i.HttpRequest.Context(), i.timeout)
+		if i.cancel != nil {
+			previous := i.cancel
+			i.cancel = func() {
+				cancel()
+				previous()
+			}
+		} else {
+			i.cancel = cancel
+		}
+		i.HttpRequest = i.HttpRequest.WithContext(ctx)
+		i.timeout = 0
+	}
 	return i.HttpRequest, i.Error
 }
@@ -0,0 +1,570 @@
+package httprequest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pagination struct {
+	Page     int `url:"page"`
+	PageSize int `url:"page_size,omitempty"`
+}
+
+type listUsersQuery struct {
+	pagination
+	Name     string    `url:"name,omitempty"`
+	Roles    []string  `url:"role"`
+	Active   *bool     `url:"active"`
+	Since    time.Time `url:"since,omitempty"`
+	Internal string    `url:"-"`
+}
+
+func TestBuilderUrl(t *testing.T) {
+	active := true
+
+	tests := []struct {
+		name     string
+		url      string
+		build    func(b *Builder) *Builder
+		expected string
+		wantErr  bool
+	}{
+		{
+			name: "Add query to url with existing query",
+			url:  "https://example.com/users?sort=name",
+			build: func(b *Builder) *Builder {
+				return b.WithQuery(map[string]string{"q": "a&b c"})
+			},
+			expected: "https://example.com/users?q=a%26b+c&sort=name",
+		},
+		{
+			name: "Add query struct",
+			url:  "https://example.com/users",
+			build: func(b *Builder) *Builder {
+				return b.WithQueryStruct(&listUsersQuery{
+					pagination: pagination{Page: 2},
+					Roles:      []string{"admin", "user"},
+					Active:     &active,
+					Since:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+					Internal:   "secret",
+				})
+			},
+			expected: "https://example.com/users?active=true&page=2&role=admin&role=user&since=2024-01-02T03%3A04%3A05Z",
+		},
+		{
+			name: "Skip nil pointers and empty omitempty fields",
+			url:  "https://example.com/users",
+			build: func(b *Builder) *Builder {
+				return b.WithQueryStruct(listUsersQuery{})
+			},
+			expected: "https://example.com/users?page=0",
+		},
+		{
+			name: "Reject non-struct query",
+			url:  "https://example.com/users",
+			build: func(b *Builder) *Builder {
+				return b.WithQueryStruct("page=1")
+			},
+			wantErr: true,
+		},
+		{
+			name: "Escape path params",
+			url:  "https://example.com/users/{id}/posts/{postId}",
+			build: func(b *Builder) *Builder {
+				return b.WithPathParams(map[string]string{"id": "a/b c", "postId": "1?x"})
+			},
+			expected: "https://example.com/users/a%2Fb%20c/posts/1%3Fx",
+		},
+		{
+			name: "Substitute path params in a single pass",
+			url:  "https://example.com/users/{id}/posts/{postId}",
+			build: func(b *Builder) *Builder {
+				return b.WithPathParam("id", "{postId}").WithPathParam("postId", "1")
+			},
+			expected: "https://example.com/users/%7BpostId%7D/posts/1",
+		},
+		{
+			name: "Replace path param set again",
+			url:  "https://example.com/users/{id}",
+			build: func(b *Builder) *Builder {
+				return b.WithPathParam("id", "1").WithPathParam("id", "2")
+			},
+			expected: "https://example.com/users/2",
+		},
+		{
+			name: "Reject dot path param",
+			url:  "https://example.com/users/{id}",
+			build: func(b *Builder) *Builder {
+				return b.WithPathParam("id", ".")
+			},
+			wantErr: true,
+		},
+		{
+			name: "Reject dot-dot path param",
+			url:  "https://example.com/users/{id}/posts",
+			build: func(b *Builder) *Builder {
+				return b.WithPathParams(map[string]string{"id": ".."})
+			},
+			wantErr: true,
+		},
+		{
+			name: "Reject missing path param",
+			url:  "https://example.com/users/{id}",
+			build: func(b *Builder) *Builder {
+				return b.WithPathParam("userId", "1")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := tt.build((&Builder{}).New(context.Background(), Get, tt.url)).Build()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got url %s", req.URL.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if req.URL.String() != tt.expected {
+				t.Errorf("expected url %s, got %s", tt.expected, req.URL.String())
+			}
+		})
+	}
+}
+
+func TestBuilderBody(t *testing.T) {
+	tests := []struct {
+		name                string
+		build               func(b *Builder) *Builder
+		expectedBody        string
+		expectedContentType string
+		expectedErr         error
+	}{
+		{
+			name: "Encode JSON body",
+			build: func(b *Builder) *Builder {
+				return b.WithBody(map[string]string{"name": "name"})
+			},
+			expectedBody:        `{"name":"name"}`,
+			expectedContentType: string(ApplicationJson),
+		},
+		{
+			name: "Encode form body",
+			build: func(b *Builder) *Builder {
+				return b.WithFormBody(url.Values{"grant_type": {"client_credentials"}, "scope": {"a b"}})
+			},
+			expectedBody:        "grant_type=client_credentials&scope=a+b",
+			expectedContentType: string(ApplicationFormUrlEncoded),
+		},
+		{
+			name: "Encode XML body with codec of content type",
+			build: func(b *Builder) *Builder {
+				return b.WithContentType("application/xml; charset=utf-8").WithBody(&struct {
+					XMLName struct{} `xml:"user"`
+					Name    string   `xml:"name"`
+				}{Name: "name"})
+			},
+			expectedBody:        "<user><name>name</name></user>",
+			expectedContentType: "application/xml; charset=utf-8",
+		},
+		{
+			name: "Reject body for content type without codec",
+			build: func(b *Builder) *Builder {
+				return b.WithContentType("application/x-protobuf").WithBody(map[string]string{"name": "name"})
+			},
+			expectedErr: ErrNoCodec,
+		},
+		{
+			name: "Encode struct as form body with codec of content type",
+			build: func(b *Builder) *Builder {
+				return b.WithContentType(ApplicationFormUrlEncoded).WithBody(pagination{Page: 1, PageSize: 20})
+			},
+			expectedBody:        "page=1&page_size=20",
+			expectedContentType: string(ApplicationFormUrlEncoded),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := tt.build((&Builder{}).New(context.Background(), Post, "https://example.com")).Build()
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if contentType := req.Header.Get(string(ContentTypeKey)); contentType != tt.expectedContentType {
+				t.Errorf("expected content type %s, got %s", tt.expectedContentType, contentType)
+			}
+			if req.ContentLength != int64(len(tt.expectedBody)) {
+				t.Errorf("expected content length %d, got %d", len(tt.expectedBody), req.ContentLength)
+			}
+
+			body, _ := io.ReadAll(req.Body)
+			if string(body) != tt.expectedBody {
+				t.Errorf("expected body %s, got %s", tt.expectedBody, body)
+			}
+
+			rewound, err := req.GetBody()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if body, _ = io.ReadAll(rewound); string(body) != tt.expectedBody {
+				t.Errorf("expected rewound body %s, got %s", tt.expectedBody, body)
+			}
+		})
+	}
+}
+
+func TestBuilderMultipartBody(t *testing.T) {
+	req, err := (&Builder{}).New(context.Background(), Post, "https://example.com/upload").
+		WithMultipartBody(map[string]string{"title": "report"}, MultipartFile{
+			FieldName:   "file",
+			FileName:    "report \"final\".csv",
+			ContentType: "text/csv",
+			Reader:      strings.NewReader("a,b\n1,2\n"),
+		}).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get(string(ContentTypeKey)))
+	if err != nil || mediaType != string(MultipartFormData) {
+		t.Fatalf("expected multipart content type, got %s", req.Header.Get(string(ContentTypeKey)))
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		body := req.Body
+		if attempt > 0 {
+			if body, err = req.GetBody(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		form, err := multipart.NewReader(body, params["boundary"]).ReadForm(1 << 20)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if title := form.Value["title"]; len(title) != 1 || title[0] != "report" {
+			t.Errorf("expected title field report, got %v", title)
+		}
+
+		files := form.File["file"]
+		if len(files) != 1 {
+			t.Fatalf("expected 1 file, got %d", len(files))
+		}
+		if files[0].Filename != `report "final".csv` || files[0].Header.Get("Content-Type") != "text/csv" {
+			t.Errorf("unexpected file header %v", files[0].Header)
+		}
+		file, _ := files[0].Open()
+		if content, _ := io.ReadAll(file); string(content) != "a,b\n1,2\n" {
+			t.Errorf("unexpected file content %q", content)
+		}
+	}
+}
+
+func TestBuilderReaderBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		reader        io.Reader
+		contentLength int64
+		rewindable    bool
+	}{
+		{
+			name:          "Rewind seekable reader from its initial offset",
+			reader:        func() io.Reader { r := strings.NewReader("skip:payload"); r.Seek(5, io.SeekStart); return r }(),
+			contentLength: 7,
+			rewindable:    true,
+		},
+		{
+			name:          "Rewind seekable reader of unknown length",
+			reader:        func() io.Reader { r := strings.NewReader("skip:payload"); r.Seek(5, io.SeekStart); return r }(),
+			contentLength: -1,
+			rewindable:    true,
+		},
+		{
+			name:          "Stream non-seekable reader once",
+			reader:        io.MultiReader(strings.NewReader("payload")),
+			contentLength: -1,
+		},
+		{
+			name:          "Stream seeker without ReadAt once",
+			reader:        struct{ io.ReadSeeker }{strings.NewReader("payload")},
+			contentLength: 7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := (&Builder{}).New(context.Background(), Put, "https://example.com/blob").
+				WithReaderBody(tt.reader, tt.contentLength, ApplicationOctetStream).
+				Build()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if req.ContentLength != tt.contentLength {
+				t.Errorf("expected content length %d, got %d", tt.contentLength, req.ContentLength)
+			}
+
+			if body, _ := io.ReadAll(req.Body); string(body) != "payload" {
+				t.Errorf("expected body payload, got %s", body)
+			}
+
+			if (req.GetBody != nil) != tt.rewindable {
+				t.Fatalf("expected rewindable %v", tt.rewindable)
+			}
+			if !tt.rewindable {
+				return
+			}
+
+			// Rewound bodies are read independently, e.g. by concurrent hedged requests
+			first, err := req.GetBody()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			second, _ := req.GetBody()
+			if _, err := io.ReadFull(first, make([]byte, 3)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if body, _ := io.ReadAll(second); string(body) != "payload" {
+				t.Errorf("expected rewound body payload, got %s", body)
+			}
+			if body, _ := io.ReadAll(first); string(body) != "load" {
+				t.Errorf("expected rest of rewound body load, got %s", body)
+			}
+		})
+	}
+}
+
+func TestToCurl(t *testing.T) {
+	tests := []struct {
+		name            string
+		build           func(b *Builder) *Builder
+		method          Method
+		redactedHeaders []string
+		expected        string
+	}{
+		{
+			name:     "Render get request without method",
+			method:   Get,
+			build:    func(b *Builder) *Builder { return b.WithQuery(map[string]string{"q": "it's"}) },
+			expected: `curl 'https://example.com/users?q=it%27s'`,
+		},
+		{
+			name:     "Render head request with -I",
+			method:   Head,
+			build:    func(b *Builder) *Builder { return b },
+			expected: `curl -I 'https://example.com/users'`,
+		},
+		{
+			name:   "Render body and escape quotes",
+			method: Post,
+			build: func(b *Builder) *Builder {
+				return b.WithBody(map[string]string{"name": "it's"})
+			},
+			expected: `curl -X 'POST' 'https://example.com/users' -H 'Content-Type: application/json' --data-binary '{"name":"it'\''s"}'`,
+		},
+		{
+			name:   "Redact headers case-insensitively",
+			method: Delete,
+			build: func(b *Builder) *Builder {
+				return b.WithAuth("Bearer secret").WithHeaders(map[string]string{"X-Trace": "1"})
+			},
+			redactedHeaders: []string{"authorization"},
+			expected:        `curl -X 'DELETE' 'https://example.com/users' -H 'Authorization: *REDACTED*' -H 'X-Trace: 1'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := tt.build((&Builder{}).New(context.Background(), tt.method, "https://example.com/users")).Build()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if curl := ToCurl(req, tt.redactedHeaders...); curl != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, curl)
+			}
+			if req.Body != nil {
+				if body, _ := io.ReadAll(req.Body); len(body) == 0 {
+					t.Errorf("expected body to be set back")
+				}
+			}
+		})
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	template := &Template{
+		BaseUrl: "https://example.com/v1/",
+		Header:  http.Header{"Accept": {"application/json"}},
+		Auth:    "Bearer token",
+		Timeout: time.Minute,
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		build       func(b *Builder) *Builder
+		expectedUrl string
+		expectedHdr http.Header
+	}{
+		{
+			name:        "Join base url and path",
+			path:        "/users/{id}",
+			build:       func(b *Builder) *Builder { return b.WithPathParam("id", "1") },
+			expectedUrl: "https://example.com/v1/users/1",
+			expectedHdr: http.Header{"Accept": {"application/json"}, "Authorization": {"Bearer token"}},
+		},
+		{
+			name:        "Join path with absolute url in its query",
+			path:        "/login?next=https://other.com",
+			build:       func(b *Builder) *Builder { return b },
+			expectedUrl: "https://example.com/v1/login?next=https://other.com",
+			expectedHdr: http.Header{"Accept": {"application/json"}, "Authorization": {"Bearer token"}},
+		},
+		{
+			name:        "Keep absolute url and add headers without changing the template",
+			path:        "https://other.com/health",
+			build:       func(b *Builder) *Builder { return b.WithHeaders(map[string]string{"Accept": "text/plain"}) },
+			expectedUrl: "https://other.com/health",
+			expectedHdr: http.Header{"Accept": {"application/json", "text/plain"}, "Authorization": {"Bearer token"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := tt.build(template.New(context.Background(), Get, tt.path))
+			defer builder.Cancel()
+
+			req, err := builder.Build()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if req.URL.String() != tt.expectedUrl {
+				t.Errorf("expected url %s, got %s", tt.expectedUrl, req.URL.String())
+			}
+			if !reflect.DeepEqual(req.Header, tt.expectedHdr) {
+				t.Errorf("expected headers %v, got %v", tt.expectedHdr, req.Header)
+			}
+			if _, ok := req.Context().Deadline(); !ok {
+				t.Errorf("expected request deadline")
+			}
+		})
+	}
+
+	if len(template.Header["Accept"]) != 1 {
+		t.Errorf("expected template headers to be unchanged, got %v", template.Header)
+	}
+}
+
+func TestBuilderClone(t *testing.T) {
+	original := (&Builder{}).New(context.Background(), Post, "https://example.com/users").
+		WithHeaders(map[string]string{"X-Trace": "1"}).
+		WithBody(map[string]string{"name": "name"})
+
+	clone := original.Clone().WithHeaders(map[string]string{"X-Trace": "2"}).WithQuery(map[string]string{"dry_run": "true"})
+
+	originalReq, _ := original.Build()
+	cloneReq, err := clone.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if values := originalReq.Header.Values("X-Trace"); len(values) != 1 {
+		t.Errorf("expected original headers to be unchanged, got %v", values)
+	}
+	if originalReq.URL.RawQuery != "" {
+		t.Errorf("expected original url to be unchanged, got %s", originalReq.URL.String())
+	}
+
+	originalBody, _ := io.ReadAll(originalReq.Body)
+	cloneBody, _ := io.ReadAll(cloneReq.Body)
+	if string(originalBody) != `{"name":"name"}` || string(cloneBody) != string(originalBody) {
+		t.Errorf("expected independent bodies, got %s and %s", originalBody, cloneBody)
+	}
+}
+
+func TestBuilderCloneBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		build       func(b *Builder) *Builder
+		expectError bool
+	}{
+		{
+			name:  "Clone request without body",
+			build: func(b *Builder) *Builder { return b },
+		},
+		{
+			name: "Clone rewindable reader body",
+			build: func(b *Builder) *Builder {
+				return b.WithReaderBody(strings.NewReader("payload"), 7, ApplicationOctetStream)
+			},
+		},
+		{
+			name: "Reject body that cannot be rewound",
+			build: func(b *Builder) *Builder {
+				return b.WithReaderBody(io.MultiReader(strings.NewReader("payload")), -1, ApplicationOctetStream)
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := tt.build((&Builder{}).New(context.Background(), Put, "https://example.com/blob"))
+			_, err := original.Clone().Build()
+			if (err != nil) != tt.expectError {
+				t.Errorf("expected error %v, got %v", tt.expectError, err)
+			}
+			if _, err := original.Build(); err != nil {
+				t.Errorf("expected original to be unaffected, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBuilderTimeout(t *testing.T) {
+	builder := (&Builder{}).New(context.Background(), Get, "https://example.com/users").WithTimeout(time.Minute)
+	if _, ok := builder.HttpRequest.Context().Deadline(); ok {
+		t.Fatalf("expected timeout to start on Build")
+	}
+	clone := builder.Clone()
+
+	builtAt := time.Now()
+	req, err := builder.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deadline, ok := req.Context().Deadline(); !ok || deadline.Before(builtAt.Add(time.Minute)) {
+		t.Errorf("expected deadline a minute after Build, got %v", deadline)
+	}
+
+	cloneReq, _ := clone.Build()
+	builder.Cancel()
+	if !errors.Is(req.Context().Err(), context.Canceled) {
+		t.Errorf("expected request to be cancelled, got %v", req.Context().Err())
+	}
+	if err := cloneReq.Context().Err(); err != nil {
+		t.Errorf("expected clone to keep its own timeout, got %v", err)
+	}
+	clone.Cancel()
+}
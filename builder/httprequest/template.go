@@ -0,0 +1,68 @@
+package httprequest
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Template holds the base of the requests to a service, from which independent Builders are derived.
+//
+// Example:
+//
+//	partner := &httprequest.Template{
+//		BaseUrl: "https://api.partner.com/v1",
+//		Header:  http.Header{"Accept": {"application/json"}},
+//		Auth:    "Bearer " + token,
+//		Timeout: 5 * time.Second,
+//	}
+//	builder := partner.New(ctx, httprequest.Get, "/users/{id}").WithPathParam("id", id)
+//	defer builder.Cancel()
+//
+// A Template must not be modified while it is in use, and is then safe for concurrent use.
+type Template struct {
+	// BaseUrl is prepended to the paths of the requests, unless they are absolute urls.
+	BaseUrl string
+	// Header is deep-copied into every request.
+	Header http.Header
+	// Auth sets the `Authorization` header, empty sends no header.
+	Auth string
+	// Timeout is applied with Builder.WithTimeout, starting when the request is built, 0 sets no timeout.
+	Timeout time.Duration
+}
+
+// New creates a new Builder of a request to path, with the base url, headers, auth and timeout of the Template.
+func (t *Template) New(ctx context.Context, method Method, path string) *Builder {
+	builder := (&Builder{}).New(ctx, method, t.resolve(path))
+	if builder.Error != nil {
+		return builder
+	}
+
+	for name, values := range t.Header {
+		for _, value := range values {
+			builder.HttpRequest.Header.Add(name, value)
+		}
+	}
+	if t.Auth != "" {
+		builder = builder.WithAuth(t.Auth)
+	}
+	if t.Timeout > 0 {
+		builder = builder.WithTimeout(t.Timeout)
+	}
+	return builder
+}
+
+func (t *Template) resolve(path string) string {
+	if t.BaseUrl == "" {
+		return path
+	}
+	if u, err := url.Parse(path); err == nil && u.IsAbs() {
+		return path
+	}
+	if path == "" {
+		return t.BaseUrl
+	}
+	return strings.TrimSuffix(t.BaseUrl, "/") + "/" + strings.TrimPrefix(path, "/")
+}
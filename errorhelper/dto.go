@@ -16,6 +16,14 @@ func NewInternalServerError(err error) *ErrorResponse {
 	}
 }
 
+func NewTooManyRequestsError(err error) *ErrorResponse {
+	return &ErrorResponse{
+		Message: "Too many requests, please try again later",
+		Code:    429,
+		Data:    err.Error(),
+	}
+}
+
 func NewValidationError(fieldErrs []validator.FieldError, err error) *ErrorResponse {
 	message := "Please check your inputs and try again"
 	if fieldErrs != nil && len(fieldErrs) > 0 {
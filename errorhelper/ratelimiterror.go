@@ -0,0 +1,23 @@
+package errorhelper
+
+import (
+	"fmt"
+	"time"
+)
+
+// RateLimitError is an error type for requests rejected by rate limiting
+type RateLimitError struct {
+	// RetryAfter is how long until the request may be retried, 0 if unknown.
+	RetryAfter time.Duration
+}
+
+// NewRateLimitError creates a new RateLimitError
+func NewRateLimitError(retryAfter time.Duration) *RateLimitError {
+	return &RateLimitError{
+		RetryAfter: retryAfter,
+	}
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("Too Many Requests, Retry After: %s", e.RetryAfter)
+}
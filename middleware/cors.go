@@ -1,8 +1,18 @@
 package middleware
 
-import "net/http"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
 
 // CORS adds the necessary headers to allow CORS requests.
+//
+// It allows any origin without credentials, use CORSPolicy for anything else.
 func CORS(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -18,3 +28,230 @@ func CORS(next http.HandlerFunc) http.HandlerFunc {
 		next.ServeHTTP(w, r)
 	}
 }
+
+// CORSConfig is the configuration for the CORSPolicy.
+type CORSConfig struct {
+	// AllowedOrigins are exact origins, e.g. "https://app.example.com",
+	// wildcard subdomains, e.g. "https://*.example.com", or "*" for any origin.
+	AllowedOrigins []string `yaml:"allowedOrigins" json:"allowedOrigins"`
+	// AllowedOriginPatterns are regular expressions matched against the whole origin.
+	AllowedOriginPatterns []string `yaml:"allowedOriginPatterns" json:"allowedOriginPatterns"`
+	// AllowOriginFunc allows the origins it returns true for, in addition to the ones above.
+	AllowOriginFunc func(r *http.Request, origin string) bool `yaml:"-" json:"-"`
+	// AllowedMethods are the methods allowed in preflight requests.
+	AllowedMethods []string `yaml:"allowedMethods" json:"allowedMethods"`
+	// AllowedHeaders are the request headers allowed in preflight requests, "*" allows any header.
+	AllowedHeaders []string `yaml:"allowedHeaders" json:"allowedHeaders"`
+	// ExposedHeaders are the response headers readable by the browser, e.g. "X-Request-ID".
+	ExposedHeaders []string `yaml:"exposedHeaders" json:"exposedHeaders"`
+	// AllowCredentials allows cookies and `Authorization` headers from the allowed origins, which are then reflected.
+	// It cannot be combined with the "*" origin.
+	AllowCredentials bool `yaml:"allowCredentials" json:"allowCredentials"`
+	// MaxAge is how long in seconds browsers may cache preflight responses, 0 sends no `Access-Control-Max-Age`.
+	MaxAge int `yaml:"maxAge" json:"maxAge"`
+	// Routes override the policy for paths starting with their key, e.g. "/public/", the longest prefix taking precedence.
+	Routes map[string]CORSConfig `yaml:"routes" json:"routes"`
+}
+
+// DefaultCORSConfig returns a CORSConfig that allows any origin without credentials,
+// with the headers used by this module and a preflight cache of 10 minutes.
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{
+			http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions,
+		},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-Request-ID", "Idempotency-Key"},
+		ExposedHeaders: []string{"X-Request-ID"},
+		MaxAge:         600,
+	}
+}
+
+// CORSPolicy handles CORS and preflight requests according to a CORSConfig.
+type CORSPolicy struct {
+	policy *corsPolicy
+	routes map[string]*corsPolicy
+	// prefixes are the route keys sorted from longest to shortest.
+	prefixes []string
+}
+
+type corsPolicy struct {
+	cfg      CORSConfig
+	patterns []*regexp.Regexp
+}
+
+// NewCORSPolicy creates a new CORSPolicy, returning an error if an origin pattern is not a valid regular expression,
+// or if credentials are allowed for any origin "*".
+func NewCORSPolicy(cfg CORSConfig) (*CORSPolicy, error) {
+	policy, err := newCorsPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &CORSPolicy{policy: policy, routes: make(map[string]*corsPolicy)}
+	for prefix, routeCfg := range cfg.Routes {
+		if p.routes[prefix], err = newCorsPolicy(routeCfg); err != nil {
+			return nil, fmt.Errorf("invalid cors route %s: %w", prefix, err)
+		}
+		p.prefixes = append(p.prefixes, prefix)
+	}
+	slices.SortFunc(p.prefixes, func(a, b string) int {
+		return len(b) - len(a)
+	})
+	return p, nil
+}
+
+func newCorsPolicy(cfg CORSConfig) (*corsPolicy, error) {
+	if cfg.AllowCredentials && slices.Contains(cfg.AllowedOrigins, "*") {
+		return nil, errors.New("cors cannot allow credentials for any origin *")
+	}
+
+	policy := &corsPolicy{cfg: cfg}
+	for _, pattern := range cfg.AllowedOriginPatterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid cors origin pattern %s: %w", pattern, err)
+		}
+		policy.patterns = append(policy.patterns, re)
+	}
+	return policy, nil
+}
+
+// CORS is a middleware that adds the CORS headers of the policy to allowed origins, and answers their preflight requests.
+//
+// Preflight requests from origins that are not allowed, or for methods or headers that are not allowed, get 403 Forbidden.
+// Other requests are passed on without CORS headers, so that browsers block their responses.
+func (p *CORSPolicy) CORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policy := p.route(r.URL.Path)
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// Responses depend on the origin, so caches must not share them across origins
+		w.Header().Add("Vary", "Origin")
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !policy.allowsOrigin(r, origin) {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if preflight {
+			policy.handlePreflight(w, r, origin)
+			return
+		}
+
+		policy.setOriginHeaders(w, origin)
+		if len(policy.cfg.ExposedHeaders) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.cfg.ExposedHeaders, ", "))
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// route returns the policy of the longest route prefix of path, or the default policy.
+func (p *CORSPolicy) route(path string) *corsPolicy {
+	for _, prefix := range p.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return p.routes[prefix]
+		}
+	}
+	return p.policy
+}
+
+func (c *corsPolicy) handlePreflight(w http.ResponseWriter, r *http.Request, origin string) {
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !slices.Contains(c.cfg.AllowedMethods, method) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	var requestedHeaders []string
+	for _, value := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, header := range strings.Split(value, ",") {
+			if header = strings.TrimSpace(header); header != "" {
+				requestedHeaders = append(requestedHeaders, header)
+			}
+		}
+	}
+	for _, header := range requestedHeaders {
+		if !c.allowsHeader(header) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+
+	c.setOriginHeaders(w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.cfg.AllowedMethods, ", "))
+	if len(requestedHeaders) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+	}
+	if c.cfg.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(c.cfg.MaxAge))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setOriginHeaders allows origin, with credentials if AllowCredentials is set.
+//
+// Credentials are never sent with the "*" origin, as newCorsPolicy rejects AllowCredentials together with it.
+func (c *corsPolicy) setOriginHeaders(w http.ResponseWriter, origin string) {
+	if slices.Contains(c.cfg.AllowedOrigins, "*") {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.cfg.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// allowsOrigin reports whether origin is allowed by AllowedOrigins, AllowedOriginPatterns or AllowOriginFunc.
+func (c *corsPolicy) allowsOrigin(r *http.Request, origin string) bool {
+	for _, allowedOrigin := range c.cfg.AllowedOrigins {
+		if allowedOrigin == "*" || strings.EqualFold(allowedOrigin, origin) || matchesWildcard(allowedOrigin, origin) {
+			return true
+		}
+	}
+	for _, pattern := range c.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return c.cfg.AllowOriginFunc != nil && c.cfg.AllowOriginFunc(r, origin)
+}
+
+func (c *corsPolicy) allowsHeader(header string) bool {
+	for _, allowed := range c.cfg.AllowedHeaders {
+		if allowed == "*" || strings.EqualFold(allowed, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesWildcard reports whether origin matches a wildcard subdomain origin, e.g. "https://*.example.com".
+// The wildcard matches one or more subdomains, but not the bare domain.
+func matchesWildcard(allowed, origin string) bool {
+	prefix, suffix, ok := strings.Cut(strings.ToLower(allowed), "*")
+	if !ok {
+		return false
+	}
+	origin = strings.ToLower(origin)
+	return len(origin) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) &&
+		strings.HasSuffix(origin, suffix) &&
+		!strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:")
+}
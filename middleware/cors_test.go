@@ -0,0 +1,227 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORSPolicy(t *testing.T) {
+	cfg := CORSConfig{
+		AllowedOrigins:        []string{"https://app.example.com", "https://*.example.org"},
+		AllowedOriginPatterns: []string{`https://pr-\d+\.preview\.example\.net`},
+		AllowOriginFunc: func(r *http.Request, origin string) bool {
+			return origin == "https://partner.example.io"
+		},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders:   []string{"Content-Type", "X-Request-ID"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           600,
+		Routes: map[string]CORSConfig{
+			"/public/": {AllowedOrigins: []string{"*"}, AllowedMethods: []string{http.MethodGet}},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		headers        map[string]string
+		expectedStatus int
+		expectedHeader map[string]string
+		expectNext     bool
+	}{
+		{
+			name:           "Allow exact origin with credentials",
+			method:         http.MethodGet,
+			path:           "/users",
+			headers:        map[string]string{"Origin": "https://app.example.com"},
+			expectedStatus: http.StatusOK,
+			expectedHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Request-ID",
+				"Vary":                             "Origin",
+			},
+			expectNext: true,
+		},
+		{
+			name:           "Allow wildcard subdomain",
+			method:         http.MethodGet,
+			path:           "/users",
+			headers:        map[string]string{"Origin": "https://a.b.example.org"},
+			expectedStatus: http.StatusOK,
+			expectedHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://a.b.example.org",
+				"Access-Control-Allow-Credentials": "true",
+			},
+			expectNext: true,
+		},
+		{
+			name:           "Reject bare domain of wildcard subdomain",
+			method:         http.MethodGet,
+			path:           "/users",
+			headers:        map[string]string{"Origin": "https://example.org"},
+			expectedStatus: http.StatusOK,
+			expectedHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+			expectNext:     true,
+		},
+		{
+			name:           "Allow regex origin with credentials",
+			method:         http.MethodGet,
+			path:           "/users",
+			headers:        map[string]string{"Origin": "https://pr-42.preview.example.net"},
+			expectedStatus: http.StatusOK,
+			expectedHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://pr-42.preview.example.net",
+				"Access-Control-Allow-Credentials": "true",
+			},
+			expectNext: true,
+		},
+		{
+			name:           "Reject origin not matching the whole regex",
+			method:         http.MethodGet,
+			path:           "/users",
+			headers:        map[string]string{"Origin": "https://pr-42.preview.example.net.evil.com"},
+			expectedStatus: http.StatusOK,
+			expectedHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+			expectNext:     true,
+		},
+		{
+			name:   "Answer allowed preflight",
+			method: http.MethodOptions,
+			path:   "/users",
+			headers: map[string]string{
+				"Origin":                         "https://partner.example.io",
+				"Access-Control-Request-Method":  http.MethodPost,
+				"Access-Control-Request-Headers": "content-type, x-request-id",
+			},
+			expectedStatus: http.StatusNoContent,
+			expectedHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://partner.example.io",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "GET, POST",
+				"Access-Control-Allow-Headers":     "content-type, x-request-id",
+				"Access-Control-Max-Age":           "600",
+			},
+		},
+		{
+			name:   "Forbid preflight with disallowed header",
+			method: http.MethodOptions,
+			path:   "/users",
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  http.MethodPost,
+				"Access-Control-Request-Headers": "X-Debug",
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:           "Use route policy",
+			method:         http.MethodGet,
+			path:           "/public/docs",
+			headers:        map[string]string{"Origin": "https://anyone.com"},
+			expectedStatus: http.StatusOK,
+			expectedHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+			},
+			expectNext: true,
+		},
+		{
+			name:           "Pass non-CORS options request to next",
+			method:         http.MethodOptions,
+			path:           "/users",
+			expectedStatus: http.StatusOK,
+			expectNext:     true,
+		},
+	}
+
+	policy, err := NewCORSPolicy(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calledNext bool
+			handler := policy.CORS(func(w http.ResponseWriter, r *http.Request) {
+				calledNext = true
+			})
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if calledNext != tt.expectNext {
+				t.Errorf("expected next called %v, got %v", tt.expectNext, calledNext)
+			}
+			for k, v := range tt.expectedHeader {
+				got := rec.Header().Get(k)
+				if k == "Vary" {
+					got = strings.Join(rec.Header().Values(k), ", ")
+				}
+				if got != v {
+					t.Errorf("expected header %s %q, got %q", k, v, got)
+				}
+			}
+		})
+	}
+}
+
+func TestNewCORSPolicyInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         CORSConfig
+		expectError bool
+	}{
+		{
+			name:        "Reject invalid origin pattern",
+			cfg:         CORSConfig{AllowedOriginPatterns: []string{"https://("}},
+			expectError: true,
+		},
+		{
+			name:        "Reject credentials for any origin",
+			cfg:         CORSConfig{AllowedOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true},
+			expectError: true,
+		},
+		{
+			name: "Reject credentials for any origin of route",
+			cfg: CORSConfig{
+				AllowedOrigins: []string{"https://app.example.com"},
+				Routes:         map[string]CORSConfig{"/public/": {AllowedOrigins: []string{"*"}, AllowCredentials: true}},
+			},
+			expectError: true,
+		},
+		{
+			name: "Allow credentials for exact, wildcard subdomain, regex and callback origins",
+			cfg: CORSConfig{
+				AllowedOrigins:        []string{"https://app.example.com", "https://*.example.org"},
+				AllowedOriginPatterns: []string{`https://pr-\d+\.preview\.example\.net`},
+				AllowOriginFunc:       func(r *http.Request, origin string) bool { return true },
+				AllowCredentials:      true,
+			},
+		},
+		{
+			name: "Allow any origin without credentials",
+			cfg:  DefaultCORSConfig(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewCORSPolicy(tt.cfg); (err != nil) != tt.expectError {
+				t.Errorf("expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
@@ -29,6 +29,12 @@ func ErrorHandler(next http.HandlerFunc) http.HandlerFunc {
 				return
 			}
 
+			var rateLimitError *errorhelper.RateLimitError
+			if errors.As(err, &rateLimitError) {
+				HandleRateLimitError(w, rateLimitError)
+				return
+			}
+
 			var invalidValidationErr *validator.InvalidValidationError
 			if errors.As(err, &invalidValidationErr) {
 				HandleInvalidValidationError(w, invalidValidationErr)
@@ -76,6 +82,17 @@ func HandleAuthError(w http.ResponseWriter, appError *errorhelper.AuthError) {
 	_, _ = w.Write(marshal)
 }
 
+func HandleRateLimitError(w http.ResponseWriter, rateLimitError *errorhelper.RateLimitError) {
+	marshal, err := json.Marshal(errorhelper.NewTooManyRequestsError(rateLimitError))
+	if err != nil {
+		HandleInternalServerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusTooManyRequests)
+	_, _ = w.Write(marshal)
+}
+
 func HandleInvalidValidationError(w http.ResponseWriter, validationErr *validator.InvalidValidationError) {
 	marshal, err := json.Marshal(errorhelper.NewValidationError(nil, validationErr))
 	if err != nil {
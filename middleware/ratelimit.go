@@ -1,75 +1,203 @@
 package middleware
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"math"
 	"net"
 	"net/http"
+	"path"
+	"slices"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/raythx98/gohelpme/builder/httprequest"
+	"github.com/raythx98/gohelpme/errorhelper"
 	"github.com/raythx98/gohelpme/tool/logger"
-
-	"golang.org/x/time/rate"
+	"github.com/raythx98/gohelpme/tool/reqctx"
 )
 
+// RateConfig is the limit of a bucket.
+//
+// The TokenBucket algorithm allows Burst requests at once, refilled at Rate per second.
+// The FixedWindow and SlidingWindow algorithms allow Limit requests per Window, e.g. 1000 per 24h.
 type RateConfig struct {
+	Algorithm Algorithm `yaml:"algorithm" json:"algorithm"`
+
 	Rate  float64 `yaml:"rate" json:"rate"`
 	Burst int     `yaml:"burst" json:"burst"`
+
+	Limit  int           `yaml:"limit" json:"limit"`
+	Window time.Duration `yaml:"window" json:"window"`
 }
 
-type Config struct {
+// PlanConfig is the limits of a plan, e.g. a pricing tier, used instead of the limits of the Config.
+//
+// Operations and the Default not configured for the plan fall back to the ones of the Config.
+type PlanConfig struct {
 	Default    RateConfig            `yaml:"default" json:"default"`
 	Operations map[string]RateConfig `yaml:"operations" json:"operations"`
 }
 
+const (
+	DefaultCleanupInterval = time.Minute
+	DefaultIdleTimeout     = 10 * time.Minute
+	DefaultMaxKeys         = 100_000
+)
+
+type Config struct {
+	Default RateConfig `yaml:"default" json:"default"`
+	// Operations are the limits per operation, e.g. "GET:/users".
+	// Keys may be path.Match patterns such as "GET:/users/*" or "*:/admin/*", the longest matching pattern is used,
+	// and every operation matching a pattern shares one bucket.
+	Operations map[string]RateConfig `yaml:"operations" json:"operations"`
+
+	// Plans are the limits per plan, selected by PlanFunc.
+	Plans map[string]PlanConfig `yaml:"plans" json:"plans"`
+	// PlanFunc returns the plan of the request, e.g. of the authenticated user, the limits of the Config are used if there is none.
+	PlanFunc func(r *http.Request) string `yaml:"-" json:"-"`
+
+	// CleanupInterval is how often the MemoryLimiterStore evicts idle buckets, DefaultCleanupInterval if 0.
+	CleanupInterval time.Duration `yaml:"cleanupInterval" json:"cleanupInterval"`
+	// IdleTimeout is how long a bucket of the MemoryLimiterStore is kept after its last request, DefaultIdleTimeout if 0.
+	IdleTimeout time.Duration `yaml:"idleTimeout" json:"idleTimeout"`
+	// MaxKeys is the maximum number of buckets kept by the MemoryLimiterStore, DefaultMaxKeys if 0.
+	MaxKeys int `yaml:"maxKeys" json:"maxKeys"`
+}
+
 type RateLimiter struct {
 	config       Config
+	operations   operationLimits
+	plans        map[string]operationLimits
 	log          logger.ILogger
-	limiters     sync.Map
-	keyExtractor func(r *http.Request) (ip string, operation string)
-	cleanup      *time.Ticker
+	store        ILimiterStore
+	keyExtractor func(r *http.Request) (identity string, operation string)
 }
 
+// NewRateLimiter creates a new RateLimiter that keeps its limits in a MemoryLimiterStore.
+// An invalid RateConfig in cfg is logged as fatal, use NewValidatedRateLimiter to handle it instead.
+//
+// Close must be called to stop the cleanup goroutine of the store once the RateLimiter is no longer used.
 func NewRateLimiter(cfg Config, log logger.ILogger, extractor func(r *http.Request) (string, string)) *RateLimiter {
-	rl := &RateLimiter{
+	rl, err := NewValidatedRateLimiter(cfg, log, extractor, nil)
+	if err != nil {
+		log.Fatal(context.Background(), "invalid rate limit config", logger.WithError(err))
+	}
+	return rl
+}
+
+// NewRateLimiterWithStore creates a new RateLimiter that keeps its limits in store,
+// e.g. a PostgresLimiterStore to share them across replicas.
+// An invalid RateConfig in cfg is logged as fatal, use NewValidatedRateLimiter to handle it instead.
+func NewRateLimiterWithStore(cfg Config, log logger.ILogger, extractor func(r *http.Request) (string, string), store ILimiterStore) *RateLimiter {
+	rl, err := NewValidatedRateLimiter(cfg, log, extractor, store)
+	if err != nil {
+		log.Fatal(context.Background(), "invalid rate limit config", logger.WithError(err))
+	}
+	return rl
+}
+
+// NewValidatedRateLimiter creates a new RateLimiter that keeps its limits in store, or in a MemoryLimiterStore if nil,
+// returning an ErrInvalidRateConfig if any RateConfig of cfg is invalid.
+func NewValidatedRateLimiter(cfg Config, log logger.ILogger, extractor func(r *http.Request) (string, string), store ILimiterStore) (*RateLimiter, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if store == nil {
+		store = NewMemoryLimiterStore(cfg)
+	}
+
+	plans := make(map[string]operationLimits, len(cfg.Plans))
+	for name, plan := range cfg.Plans {
+		plans[name] = newOperationLimits(plan.Operations)
+	}
+
+	return &RateLimiter{
 		config:       cfg,
+		operations:   newOperationLimits(cfg.Operations),
+		plans:        plans,
 		log:          log,
+		store:        store,
 		keyExtractor: extractor,
-		cleanup:      time.NewTicker(10 * time.Minute),
+	}, nil
+}
+
+// validate returns an ErrInvalidRateConfig for the first invalid RateConfig of c, including the ones of its plans.
+func (c Config) validate() error {
+	if err := c.Default.validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
 	}
-	go rl.startCleanup()
-	return rl
+	for operation, limitConfig := range c.Operations {
+		if err := limitConfig.validate(); err != nil {
+			return fmt.Errorf("operation %s: %w", operation, err)
+		}
+	}
+	for name, plan := range c.Plans {
+		if err := plan.Default.validate(); err != nil {
+			return fmt.Errorf("plan %s default: %w", name, err)
+		}
+		for operation, limitConfig := range plan.Operations {
+			if err := limitConfig.validate(); err != nil {
+				return fmt.Errorf("plan %s operation %s: %w", name, operation, err)
+			}
+		}
+	}
+	return nil
 }
 
-func (rl *RateLimiter) startCleanup() {
-	for range rl.cleanup.C {
-		rl.limiters.Range(func(key, value any) bool {
-			rl.limiters.Delete(key)
-			return true
-		})
+// Close closes the store of the RateLimiter if it is an io.Closer, e.g. the MemoryLimiterStore.
+func (rl *RateLimiter) Close() error {
+	if closer, ok := rl.store.(io.Closer); ok {
+		return closer.Close()
 	}
+	return nil
 }
 
 func (rl *RateLimiter) RateLimit(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ip, operation := rl.keyExtractor(r)
+		identity, operation := rl.keyExtractor(r)
 
-		limitConfig := rl.config.Default
-		if opConfig, ok := rl.config.Operations[operation]; ok {
-			limitConfig = opConfig
+		var plan string
+		if rl.config.PlanFunc != nil {
+			plan = rl.config.PlanFunc(r)
 		}
+		limitConfig, bucket := rl.limitsFor(plan, operation)
 
-		// Key by IP and Operation to have per-endpoint limits per user
-		key := fmt.Sprintf("%s:%s", ip, operation)
+		// Key by identity and operation to have per-endpoint limits per user
+		key := fmt.Sprintf("%s:%s", identity, bucket)
 
-		limiter, _ := rl.limiters.LoadOrStore(key, rate.NewLimiter(rate.Limit(limitConfig.Rate), limitConfig.Burst))
-		if !limiter.(*rate.Limiter).Allow() {
-			rl.log.Warn(r.Context(), "rate limit exceeded",
-				logger.WithField("ip", ip),
+		result, err := rl.store.Take(r.Context(), key, limitConfig)
+		if err != nil {
+			// Fail open, so that an unavailable store does not take the service down with it
+			rl.log.Error(r.Context(), "rate limit store failed",
+				logger.WithError(err),
+				logger.WithField("identity", identity),
 				logger.WithField("operation", operation))
-			w.WriteHeader(http.StatusTooManyRequests)
-			_, _ = w.Write([]byte("Rate limit exceeded"))
+			next(w, r)
+			return
+		}
+
+		setRateLimitHeaders(w, result)
+
+		if !result.Allowed {
+			rl.log.Warn(r.Context(), "rate limit exceeded",
+				logger.WithField("identity", identity),
+				logger.WithField("operation", operation),
+				logger.WithField("plan", plan))
+
+			rateLimitErr := errorhelper.NewRateLimitError(result.RetryAfter)
+			if value := reqctx.GetValue(r.Context()); value != nil {
+				value.SetError(rateLimitErr)
+				return
+			}
+
+			// Without a request context there is no ErrorHandler to render the error
+			w.Header().Set(string(httprequest.ContentTypeKey), string(httprequest.ApplicationJson))
+			HandleRateLimitError(w, rateLimitErr)
 			return
 		}
 
@@ -77,6 +205,79 @@ func (rl *RateLimiter) RateLimit(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// limitsFor returns the RateConfig of operation for plan, and the name of its bucket.
+//
+// The bucket is the operation, or the pattern it matched so that all matching operations share it,
+// prefixed with the plan so that changing plans starts a new bucket.
+func (rl *RateLimiter) limitsFor(plan, operation string) (RateConfig, string) {
+	if limits, ok := rl.plans[plan]; ok {
+		if limitConfig, bucket, ok := limits.get(operation); ok {
+			return limitConfig, plan + ":" + bucket
+		}
+		if planConfig := rl.config.Plans[plan]; planConfig.Default != (RateConfig{}) {
+			return planConfig.Default, plan + ":" + operation
+		}
+	}
+
+	if limitConfig, bucket, ok := rl.operations.get(operation); ok {
+		return limitConfig, bucket
+	}
+	return rl.config.Default, operation
+}
+
+// operationLimits resolves the RateConfig of an operation, exact operations first, then the longest matching pattern.
+type operationLimits struct {
+	operations map[string]RateConfig
+	patterns   []string
+}
+
+func newOperationLimits(operations map[string]RateConfig) operationLimits {
+	limits := operationLimits{operations: operations}
+	for operation := range operations {
+		if strings.ContainsAny(operation, "*?[") {
+			limits.patterns = append(limits.patterns, operation)
+		}
+	}
+	slices.SortFunc(limits.patterns, func(a, b string) int {
+		if len(a) != len(b) {
+			return len(b) - len(a)
+		}
+		return strings.Compare(a, b)
+	})
+	return limits
+}
+
+func (l operationLimits) get(operation string) (RateConfig, string, bool) {
+	if limitConfig, ok := l.operations[operation]; ok {
+		return limitConfig, operation, true
+	}
+	for _, pattern := range l.patterns {
+		if matched, _ := path.Match(pattern, operation); matched {
+			return l.operations[pattern], pattern, true
+		}
+	}
+	return RateConfig{}, "", false
+}
+
+// setRateLimitHeaders sets the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers
+// of the IETF RateLimit header fields draft, and Retry-After if the request is not allowed.
+func setRateLimitHeaders(w http.ResponseWriter, result *LimitResult) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+	if !result.Allowed && result.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ExtractIP returns the client IP from the `X-Forwarded-For` or `X-Real-IP` headers, or the remote address.
+//
+// The headers are trusted as is, so the service must run behind a proxy that overwrites them, otherwise clients
+// can spoof any IP to get fresh buckets.
 func ExtractIP(r *http.Request) string {
 	ip := r.Header.Get("X-Forwarded-For")
 	if ip == "" {
@@ -98,3 +299,29 @@ func ExtractIP(r *http.Request) string {
 func DefaultRESTExtractor(r *http.Request) (string, string) {
 	return ExtractIP(r), fmt.Sprintf("%s:%s", r.Method, r.URL.Path)
 }
+
+// UserExtractor keys by the UserId of the reqctx.Value, e.g. set by JwtSubject, and by IP for anonymous requests.
+func UserExtractor(r *http.Request) (string, string) {
+	_, operation := DefaultRESTExtractor(r)
+	if value := reqctx.GetValue(r.Context()); value != nil && value.UserId != nil {
+		return "user:" + strconv.FormatInt(*value.UserId, 10), operation
+	}
+	return "ip:" + ExtractIP(r), operation
+}
+
+// APIKeyExtractor keys by the API key in header, and by IP for requests without one or with one that valid rejects.
+//
+// The header is set by the client, so valid must check that the key was issued, e.g. against the API key store,
+// otherwise a client can send a made-up key on every request to get a fresh bucket.
+// A nil valid accepts every key, so only pass nil if the key is already authenticated before the RateLimiter runs.
+// The key is hashed so that it is not kept in the store.
+func APIKeyExtractor(header string, valid func(r *http.Request, apiKey string) bool) func(r *http.Request) (string, string) {
+	return func(r *http.Request) (string, string) {
+		_, operation := DefaultRESTExtractor(r)
+		if apiKey := r.Header.Get(header); apiKey != "" && (valid == nil || valid(r, apiKey)) {
+			sum := sha256.Sum256([]byte(apiKey))
+			return "key:" + hex.EncodeToString(sum[:]), operation
+		}
+		return "ip:" + ExtractIP(r), operation
+	}
+}
@@ -0,0 +1,483 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/raythx98/gohelpme/errorhelper"
+	"github.com/raythx98/gohelpme/tool/logger"
+	"github.com/raythx98/gohelpme/tool/reqctx"
+)
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name            string
+		withReqCtx      bool
+		requests        int
+		expectedStatus  int
+		expectedHeaders map[string]string
+	}{
+		{
+			name:           "Allow request within burst",
+			withReqCtx:     true,
+			requests:       1,
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"RateLimit-Limit":     "2",
+				"RateLimit-Remaining": "1",
+				"RateLimit-Reset":     "1",
+				"Retry-After":         "",
+			},
+		},
+		{
+			name:           "Reject request over burst through ErrorHandler",
+			withReqCtx:     true,
+			requests:       3,
+			expectedStatus: http.StatusTooManyRequests,
+			expectedHeaders: map[string]string{
+				"RateLimit-Limit":     "2",
+				"RateLimit-Remaining": "0",
+				"RateLimit-Reset":     "2",
+				"Retry-After":         "1",
+			},
+		},
+		{
+			name:           "Reject request over burst without request context",
+			requests:       3,
+			expectedStatus: http.StatusTooManyRequests,
+			expectedHeaders: map[string]string{
+				"Content-Type": "application/json",
+				"Retry-After":  "1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := NewRateLimiter(Config{Default: RateConfig{Rate: 1, Burst: 2}}, logger.NewDefault(), DefaultRESTExtractor)
+			defer rl.Close()
+
+			handler := rl.RateLimit(func(w http.ResponseWriter, r *http.Request) {})
+			if tt.withReqCtx {
+				handler = Chain(handler, ReqCtx, ErrorHandler)
+			}
+
+			var rec *httptest.ResponseRecorder
+			for i := 0; i < tt.requests; i++ {
+				rec = httptest.NewRecorder()
+				handler(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+			}
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			for k, v := range tt.expectedHeaders {
+				if got := rec.Header().Get(k); got != v {
+					t.Errorf("expected header %s %q, got %q", k, v, got)
+				}
+			}
+
+			if tt.expectedStatus != http.StatusTooManyRequests {
+				return
+			}
+			var errorResponse errorhelper.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &errorResponse); err != nil || errorResponse.Code != http.StatusTooManyRequests {
+				t.Errorf("expected 429 ErrorResponse, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestMemoryLimiterStore(t *testing.T) {
+	cfg := RateConfig{Rate: 1, Burst: 2}
+	tests := []struct {
+		name         string
+		storeConfig  Config
+		keys         []string
+		evictAfter   time.Duration
+		expectedKeys []string
+	}{
+		{
+			name:         "Evict least recently used key over MaxKeys",
+			storeConfig:  Config{MaxKeys: 2},
+			keys:         []string{"a", "b", "a", "c"},
+			expectedKeys: []string{"a", "c"},
+		},
+		{
+			name:         "Keep limiting key over MaxKeys",
+			storeConfig:  Config{MaxKeys: 2},
+			keys:         []string{"a", "a", "b", "c"},
+			expectedKeys: []string{"a", "c"},
+		},
+		{
+			name:         "Keep keys that are not idle",
+			storeConfig:  Config{IdleTimeout: time.Minute},
+			keys:         []string{"a", "b"},
+			evictAfter:   30 * time.Second,
+			expectedKeys: []string{"a", "b"},
+		},
+		{
+			name:        "Evict idle keys",
+			storeConfig: Config{IdleTimeout: time.Minute},
+			keys:        []string{"a", "b"},
+			evictAfter:  2 * time.Minute,
+		},
+		{
+			name:         "Keep idle keys until their bucket refills",
+			storeConfig:  Config{IdleTimeout: time.Second},
+			keys:         []string{"a", "a"},
+			evictAfter:   time.Second,
+			expectedKeys: []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryLimiterStore(tt.storeConfig)
+			defer store.Close()
+
+			for _, key := range tt.keys {
+				if _, err := store.Take(context.Background(), key, cfg); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if tt.evictAfter > 0 {
+				store.evictIdle(time.Now().Add(tt.evictAfter))
+			}
+
+			if store.Len() != len(tt.expectedKeys) {
+				t.Errorf("expected %d keys, got %d", len(tt.expectedKeys), store.Len())
+			}
+			for _, key := range tt.expectedKeys {
+				if _, ok := store.items[key]; !ok {
+					t.Errorf("expected key %s to be kept", key)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryLimiterStoreClose(t *testing.T) {
+	store := NewMemoryLimiterStore(Config{CleanupInterval: time.Millisecond})
+	if err := store.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("unexpected error on second close: %v", err)
+	}
+
+	select {
+	case <-store.done:
+	default:
+		t.Errorf("expected cleanup goroutine to be stopped")
+	}
+}
+
+func TestRateLimitRules(t *testing.T) {
+	cfg := Config{
+		Default: RateConfig{Rate: 1, Burst: 5},
+		Operations: map[string]RateConfig{
+			"GET:/users/*":   {Algorithm: FixedWindow, Limit: 2, Window: time.Hour},
+			"GET:/users/me":  {Rate: 1, Burst: 3},
+			"*:/admin/*":     {Algorithm: SlidingWindow, Limit: 1, Window: time.Hour},
+			"GET:/users/*/*": {Rate: 1, Burst: 4},
+		},
+		Plans: map[string]PlanConfig{
+			"pro": {Operations: map[string]RateConfig{"GET:/users/*": {Algorithm: FixedWindow, Limit: 10, Window: time.Hour}}},
+		},
+		PlanFunc: func(r *http.Request) string { return r.Header.Get("X-Plan") },
+	}
+
+	tests := []struct {
+		name           string
+		paths          []string
+		userId         *int64
+		plan           string
+		expectedStatus int
+		expectedLimit  string
+	}{
+		{
+			name:           "Use exact operation over pattern",
+			paths:          []string{"/users/me"},
+			expectedStatus: http.StatusOK,
+			expectedLimit:  "3",
+		},
+		{
+			name:           "Share bucket of pattern across operations",
+			paths:          []string{"/users/1", "/users/2", "/users/3"},
+			expectedStatus: http.StatusTooManyRequests,
+			expectedLimit:  "2",
+		},
+		{
+			name:           "Use longest matching pattern",
+			paths:          []string{"/users/1/posts"},
+			expectedStatus: http.StatusOK,
+			expectedLimit:  "4",
+		},
+		{
+			name:           "Use default without matching operation",
+			paths:          []string{"/orders"},
+			expectedStatus: http.StatusOK,
+			expectedLimit:  "5",
+		},
+		{
+			name:           "Use limits of plan",
+			paths:          []string{"/users/1", "/users/2", "/users/3"},
+			plan:           "pro",
+			expectedStatus: http.StatusOK,
+			expectedLimit:  "10",
+		},
+		{
+			name:           "Fall back to limits of config for operation not in plan",
+			paths:          []string{"/admin/stats", "/admin/users"},
+			plan:           "pro",
+			expectedStatus: http.StatusTooManyRequests,
+			expectedLimit:  "1",
+		},
+		{
+			name:           "Key by user instead of IP",
+			paths:          []string{"/users/1", "/users/2", "/users/3"},
+			userId:         func() *int64 { id := int64(1); return &id }(),
+			expectedStatus: http.StatusTooManyRequests,
+			expectedLimit:  "2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := NewRateLimiter(cfg, logger.NewDefault(), UserExtractor)
+			defer rl.Close()
+
+			// Set the user after ReqCtx, as JwtSubject would
+			withUser := func(next http.HandlerFunc) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					if tt.userId != nil {
+						reqctx.GetValue(r.Context()).SetUserId(*tt.userId)
+					}
+					next(w, r)
+				}
+			}
+			handler := Chain(rl.RateLimit(func(w http.ResponseWriter, r *http.Request) {}), ReqCtx, ErrorHandler, withUser)
+
+			var rec *httptest.ResponseRecorder
+			for i, p := range tt.paths {
+				req := httptest.NewRequest(http.MethodGet, p, nil)
+				req.Header.Set("X-Plan", tt.plan)
+				if tt.userId != nil {
+					// A different IP for every request, so that only the user ties them together
+					req.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i)
+				}
+				rec = httptest.NewRecorder()
+				handler(rec, req)
+			}
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if got := rec.Header().Get("RateLimit-Limit"); got != tt.expectedLimit {
+				t.Errorf("expected RateLimit-Limit %s, got %s", tt.expectedLimit, got)
+			}
+		})
+	}
+}
+
+func TestWindowCounter(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name              string
+		algorithm         Algorithm
+		window            time.Duration
+		requests          []time.Duration
+		expectedAllowed   bool
+		expectedRemaining int
+		expectedRetry     time.Duration
+	}{
+		{
+			name:              "Allow fixed window within limit",
+			algorithm:         FixedWindow,
+			requests:          []time.Duration{0, time.Minute},
+			expectedAllowed:   true,
+			expectedRemaining: 0,
+		},
+		{
+			name:            "Reject fixed window over limit until next window",
+			algorithm:       FixedWindow,
+			requests:        []time.Duration{0, time.Minute, 15 * time.Minute},
+			expectedAllowed: false,
+			expectedRetry:   45 * time.Minute,
+		},
+		{
+			name:              "Reset fixed window in next window",
+			algorithm:         FixedWindow,
+			requests:          []time.Duration{50 * time.Minute, 55 * time.Minute, 65 * time.Minute},
+			expectedAllowed:   true,
+			expectedRemaining: 1,
+		},
+		{
+			name:            "Reject sliding window with previous window still overlapping",
+			algorithm:       SlidingWindow,
+			requests:        []time.Duration{50 * time.Minute, 55 * time.Minute, 65 * time.Minute},
+			expectedAllowed: false,
+			expectedRetry:   25 * time.Minute,
+		},
+		{
+			name:              "Align window to the Unix epoch",
+			algorithm:         FixedWindow,
+			window:            7 * 24 * time.Hour,
+			requests:          []time.Duration{0, 12 * time.Hour, 24 * time.Hour},
+			expectedAllowed:   true,
+			expectedRemaining: 1,
+		},
+		{
+			name:              "Allow sliding window once previous window slid out",
+			algorithm:         SlidingWindow,
+			requests:          []time.Duration{50 * time.Minute, 55 * time.Minute, 95 * time.Minute},
+			expectedAllowed:   true,
+			expectedRemaining: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window := tt.window
+			if window == 0 {
+				window = time.Hour
+			}
+			counter := &windowCounter{cfg: RateConfig{Algorithm: tt.algorithm, Limit: 2, Window: window}}
+
+			var result *LimitResult
+			for _, offset := range tt.requests {
+				result = counter.take(start.Add(offset))
+			}
+
+			if result.Allowed != tt.expectedAllowed {
+				t.Errorf("expected allowed %v, got %v", tt.expectedAllowed, result.Allowed)
+			}
+			if result.Remaining != tt.expectedRemaining {
+				t.Errorf("expected remaining %d, got %d", tt.expectedRemaining, result.Remaining)
+			}
+			if result.RetryAfter != tt.expectedRetry {
+				t.Errorf("expected retry after %s, got %s", tt.expectedRetry, result.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestNewValidatedRateLimiter(t *testing.T) {
+	window := RateConfig{Algorithm: FixedWindow, Limit: 1, Window: time.Hour}
+	tests := []struct {
+		name        string
+		cfg         Config
+		expectError bool
+	}{
+		{
+			name: "Accept valid configs",
+			cfg: Config{
+				Default:    RateConfig{Rate: 1, Burst: 1},
+				Operations: map[string]RateConfig{"GET:/users": window},
+				Plans:      map[string]PlanConfig{"pro": {Operations: map[string]RateConfig{"GET:/users": window}}},
+			},
+		},
+		{
+			name:        "Reject unknown algorithm",
+			cfg:         Config{Default: RateConfig{Algorithm: "leaky_bucket"}},
+			expectError: true,
+		},
+		{
+			name:        "Reject operation without window",
+			cfg:         Config{Operations: map[string]RateConfig{"GET:/users": {Algorithm: SlidingWindow, Limit: 1}}},
+			expectError: true,
+		},
+		{
+			name:        "Reject plan default without window",
+			cfg:         Config{Plans: map[string]PlanConfig{"pro": {Default: RateConfig{Algorithm: FixedWindow, Limit: 1}}}},
+			expectError: true,
+		},
+		{
+			name: "Reject plan operation without window",
+			cfg: Config{Plans: map[string]PlanConfig{
+				"pro": {Operations: map[string]RateConfig{"GET:/users": {Algorithm: FixedWindow, Limit: 1}}},
+			}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl, err := NewValidatedRateLimiter(tt.cfg, logger.NewDefault(), DefaultRESTExtractor, nil)
+			if tt.expectError {
+				if !errors.Is(err, ErrInvalidRateConfig) {
+					t.Errorf("expected ErrInvalidRateConfig, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_ = rl.Close()
+		})
+	}
+}
+
+func TestAPIKeyExtractor(t *testing.T) {
+	valid := func(r *http.Request, apiKey string) bool {
+		return apiKey == "issued-key"
+	}
+	sum := sha256.Sum256([]byte("issued-key"))
+	madeUp := sha256.Sum256([]byte("made-up-key"))
+
+	tests := []struct {
+		name             string
+		valid            func(r *http.Request, apiKey string) bool
+		apiKey           string
+		expectedIdentity string
+	}{
+		{
+			name:             "Key by hash of valid API key",
+			valid:            valid,
+			apiKey:           "issued-key",
+			expectedIdentity: "key:" + hex.EncodeToString(sum[:]),
+		},
+		{
+			name:             "Key by hash of any API key without validator",
+			apiKey:           "made-up-key",
+			expectedIdentity: "key:" + hex.EncodeToString(madeUp[:]),
+		},
+		{
+			name:             "Key by IP for unknown API key",
+			valid:            valid,
+			apiKey:           "made-up-key",
+			expectedIdentity: "ip:192.0.2.1",
+		},
+		{
+			name:             "Key by IP without API key",
+			valid:            valid,
+			expectedIdentity: "ip:192.0.2.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+
+			identity, operation := APIKeyExtractor("X-API-Key", tt.valid)(req)
+			if identity != tt.expectedIdentity {
+				t.Errorf("expected identity %s, got %s", tt.expectedIdentity, identity)
+			}
+			if operation != "GET:/users" {
+				t.Errorf("expected operation GET:/users, got %s", operation)
+			}
+		})
+	}
+}
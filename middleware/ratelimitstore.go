@@ -0,0 +1,229 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// LimitResult is the outcome of taking a token from a rate limit bucket.
+type LimitResult struct {
+	Allowed bool
+	// Limit is the number of requests allowed at once, i.e. the Burst of a TokenBucket,
+	// or the Limit per Window of a FixedWindow or SlidingWindow.
+	Limit int
+	// Remaining is the number of whole tokens left in the bucket.
+	Remaining int
+	// RetryAfter is how long until a token is available if the request is not allowed, 0 if it never will be.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// newLimitResult returns the LimitResult of a bucket configured with cfg, holding tokens after the request was counted.
+func newLimitResult(allowed bool, tokens float64, cfg RateConfig) *LimitResult {
+	tokens = max(tokens, 0)
+	result := &LimitResult{
+		Allowed:   allowed,
+		Limit:     cfg.Burst,
+		Remaining: int(math.Floor(tokens)),
+	}
+	if cfg.Rate <= 0 {
+		return result
+	}
+
+	result.ResetAfter = time.Duration(max(float64(cfg.Burst)-tokens, 0) / cfg.Rate * float64(time.Second))
+	if !allowed && cfg.Burst >= 1 {
+		result.RetryAfter = time.Duration((1 - tokens) / cfg.Rate * float64(time.Second))
+	}
+	return result
+}
+
+// ILimiterStore is the interface for storing the token buckets of the RateLimiter.
+type ILimiterStore interface {
+	// Take takes a token from the bucket of key, created with cfg if it does not exist.
+	//
+	// cfg is valid, as checked by NewValidatedRateLimiter.
+	Take(ctx context.Context, key string, cfg RateConfig) (*LimitResult, error)
+}
+
+// MemoryLimiterStore is an ILimiterStore that keeps the buckets in process memory.
+//
+// Buckets that have been idle for IdleTimeout and have refilled or expired are evicted every CleanupInterval,
+// and the least recently used bucket that is not rejecting requests is evicted once MaxKeys buckets are tracked,
+// so that a flood of new keys, e.g. from spoofed IPs, does not reset the buckets of the clients being limited.
+//
+// Each replica of a service has its own buckets, use a shared store such as the PostgresLimiterStore to limit across replicas.
+type MemoryLimiterStore struct {
+	idleTimeout time.Duration
+	maxKeys     int
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+
+	cleanup   *time.Ticker
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type limiterEntry struct {
+	key      string
+	bucket   memoryBucket
+	lastSeen time.Time
+}
+
+// memoryBucket is the state of a key of the MemoryLimiterStore.
+type memoryBucket interface {
+	// take counts a request at now.
+	take(now time.Time) *LimitResult
+	// full reports whether the bucket is as it would be when created at now.
+	full(now time.Time) bool
+	// limiting reports whether a request at now would be rejected.
+	limiting(now time.Time) bool
+}
+
+func newMemoryBucket(cfg RateConfig) memoryBucket {
+	if cfg.Algorithm == FixedWindow || cfg.Algorithm == SlidingWindow {
+		return &windowCounter{cfg: cfg}
+	}
+	return &tokenBucket{cfg: cfg, limiter: rate.NewLimiter(rate.Limit(cfg.Rate), cfg.Burst)}
+}
+
+// tokenBucket is the state of a TokenBucket bucket of the MemoryLimiterStore.
+type tokenBucket struct {
+	cfg     RateConfig
+	limiter *rate.Limiter
+}
+
+func (b *tokenBucket) take(now time.Time) *LimitResult {
+	allowed := b.limiter.AllowN(now, 1)
+	return newLimitResult(allowed, b.limiter.TokensAt(now), b.cfg)
+}
+
+func (b *tokenBucket) full(now time.Time) bool {
+	return b.limiter.TokensAt(now) >= float64(b.cfg.Burst)
+}
+
+func (b *tokenBucket) limiting(now time.Time) bool {
+	return b.limiter.TokensAt(now) < 1
+}
+
+// NewMemoryLimiterStore creates a new MemoryLimiterStore with the CleanupInterval, IdleTimeout and MaxKeys of cfg.
+//
+// Close must be called to stop the cleanup goroutine once the store is no longer used.
+func NewMemoryLimiterStore(cfg Config) *MemoryLimiterStore {
+	if cfg.CleanupInterval <= 0 {
+		cfg.CleanupInterval = DefaultCleanupInterval
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+	if cfg.MaxKeys <= 0 {
+		cfg.MaxKeys = DefaultMaxKeys
+	}
+
+	s := &MemoryLimiterStore{
+		idleTimeout: cfg.IdleTimeout,
+		maxKeys:     cfg.MaxKeys,
+		order:       list.New(),
+		items:       make(map[string]*list.Element),
+		cleanup:     time.NewTicker(cfg.CleanupInterval),
+		done:        make(chan struct{}),
+	}
+	go s.startCleanup()
+	return s
+}
+
+func (s *MemoryLimiterStore) startCleanup() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-s.cleanup.C:
+			s.evictIdle(now)
+		}
+	}
+}
+
+// evictIdle evicts the buckets that have not been used for idleTimeout.
+// Buckets that have not refilled or expired yet are kept, so that eviction never hands out a fresh burst.
+func (s *MemoryLimiterStore) evictIdle(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The order is by last seen, so every bucket after the first recent one is recent too
+	for element := s.order.Back(); element != nil; {
+		entry := element.Value.(*limiterEntry)
+		if now.Sub(entry.lastSeen) < s.idleTimeout {
+			return
+		}
+
+		prev := element.Prev()
+		if entry.bucket.full(now) {
+			s.order.Remove(element)
+			delete(s.items, entry.key)
+		}
+		element = prev
+	}
+}
+
+// maxEvictionScan is the number of least recently used buckets checked for one that is not limiting.
+const maxEvictionScan = 64
+
+// evictLeastRecentlyUsed evicts the least recently used bucket other than the newest one that is not rejecting
+// requests, or the least recently used bucket if the maxEvictionScan oldest are all limiting.
+func (s *MemoryLimiterStore) evictLeastRecentlyUsed(now time.Time) {
+	evicted := s.order.Back()
+	for element, scanned := evicted, 0; element != s.order.Front() && scanned < maxEvictionScan; element, scanned = element.Prev(), scanned+1 {
+		if !element.Value.(*limiterEntry).bucket.limiting(now) {
+			evicted = element
+			break
+		}
+	}
+	s.order.Remove(evicted)
+	delete(s.items, evicted.Value.(*limiterEntry).key)
+}
+
+// Len returns the number of buckets tracked by the store.
+func (s *MemoryLimiterStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.order.Len()
+}
+
+// Close stops the cleanup goroutine, the buckets are kept and the store can still be used.
+func (s *MemoryLimiterStore) Close() error {
+	s.closeOnce.Do(func() {
+		s.cleanup.Stop()
+		close(s.done)
+	})
+	return nil
+}
+
+func (s *MemoryLimiterStore) Take(_ context.Context, key string, cfg RateConfig) (*LimitResult, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.items[key]
+	if ok {
+		s.order.MoveToFront(element)
+	} else {
+		element = s.order.PushFront(&limiterEntry{key: key, bucket: newMemoryBucket(cfg)})
+		s.items[key] = element
+		if s.order.Len() > s.maxKeys {
+			s.evictLeastRecentlyUsed(now)
+		}
+	}
+
+	entry := element.Value.(*limiterEntry)
+	entry.lastSeen = now
+	return entry.bucket.take(now), nil
+}
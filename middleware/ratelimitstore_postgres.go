@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/raythx98/gohelpme/tool/postgres"
+)
+
+// DefaultRateLimitTable is the table used by the PostgresLimiterStore if none is given.
+const DefaultRateLimitTable = "rate_limit_buckets"
+
+// PostgresLimiterStore is an ILimiterStore that keeps the buckets in a Postgres table shared by every replica.
+//
+// Each Take is a single atomic upsert that refills the bucket for the time elapsed since its last update,
+// or counts the request in the current window, so concurrent requests on any replica never exceed the limit.
+type PostgresLimiterStore struct {
+	db    postgres.IQuerier
+	table string
+}
+
+// NewPostgresLimiterStore creates a new PostgresLimiterStore using table, or DefaultRateLimitTable if empty.
+//
+// The table is created with CreateTable, e.g. on startup or in a migration.
+func NewPostgresLimiterStore(db postgres.IQuerier, table string) *PostgresLimiterStore {
+	if table == "" {
+		table = DefaultRateLimitTable
+	}
+	return &PostgresLimiterStore{db: db, table: pgx.Identifier{table}.Sanitize()}
+}
+
+// CreateTable creates the table of the buckets if it does not exist,
+// and adds the window columns to a table created by an earlier version.
+func (s *PostgresLimiterStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			key          TEXT PRIMARY KEY,
+			tokens       DOUBLE PRECISION NOT NULL,
+			allowed      BOOLEAN NOT NULL,
+			updated_at   TIMESTAMPTZ NOT NULL,
+			window_start TIMESTAMPTZ,
+			previous     DOUBLE PRECISION NOT NULL DEFAULT 0
+		)`, s.table))
+	if err != nil {
+		return fmt.Errorf("failed to create rate limit table: %w", err)
+	}
+
+	_, err = s.db.Exec(ctx, fmt.Sprintf(`
+		ALTER TABLE %s
+			ADD COLUMN IF NOT EXISTS window_start TIMESTAMPTZ,
+			ADD COLUMN IF NOT EXISTS previous DOUBLE PRECISION NOT NULL DEFAULT 0`, s.table))
+	if err != nil {
+		return fmt.Errorf("failed to add window columns to rate limit table: %w", err)
+	}
+	return nil
+}
+
+// DeleteIdle deletes the buckets that have not been used for idle, which are full again anyway
+// as long as idle is longer than the longest Window, or twice that for SlidingWindow.
+func (s *PostgresLimiterStore) DeleteIdle(ctx context.Context, idle time.Duration) (int64, error) {
+	tag, err := s.db.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE updated_at < now() - make_interval(secs => $1)`, s.table), idle.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete idle rate limits: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (s *PostgresLimiterStore) Take(ctx context.Context, key string, cfg RateConfig) (*LimitResult, error) {
+	if cfg.Algorithm == FixedWindow || cfg.Algorithm == SlidingWindow {
+		return s.takeWindow(ctx, key, cfg)
+	}
+
+	// $2 is the rate per second and $3 the burst, a new bucket starts full.
+	// An existing bucket is refilled for the elapsed time, capped at the burst, then a token is taken if there is one.
+	refilled := "LEAST($3::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM now() - b.updated_at), 0) * $2::float8)"
+	query := fmt.Sprintf(`
+		INSERT INTO %[1]s AS b (key, tokens, allowed, updated_at)
+		VALUES ($1, GREATEST($3::float8 - 1, 0), $3::float8 >= 1, now())
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE WHEN %[2]s >= 1 THEN %[2]s - 1 ELSE %[2]s END,
+			allowed = %[2]s >= 1,
+			updated_at = GREATEST(now(), b.updated_at)
+		RETURNING tokens, allowed`, s.table, refilled)
+
+	var tokens float64
+	var allowed bool
+	if err := s.db.QueryRow(ctx, query, key, cfg.Rate, float64(cfg.Burst)).Scan(&tokens, &allowed); err != nil {
+		return nil, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	return newLimitResult(allowed, tokens, cfg), nil
+}
+
+// takeWindow counts a request in the FixedWindow or SlidingWindow bucket of key.
+func (s *PostgresLimiterStore) takeWindow(ctx context.Context, key string, cfg RateConfig) (*LimitResult, error) {
+	// $2 is the limit, $3 the window in seconds and $4 whether it slides.
+	// The count of the stored window moves to previous once the next window starts, and both reset after that.
+	start := "to_timestamp(floor(EXTRACT(EPOCH FROM now()) / $3::float8) * $3::float8)"
+	current := fmt.Sprintf("CASE WHEN b.window_start >= %[1]s THEN b.tokens ELSE 0 END", start)
+	previous := fmt.Sprintf(`CASE
+				WHEN b.window_start >= %[1]s THEN b.previous
+				WHEN b.window_start >= %[1]s - make_interval(secs => $3::float8) THEN b.tokens
+				ELSE 0 END`, start)
+	estimate := fmt.Sprintf("%s + CASE WHEN $4::bool THEN (%s) * (1 - EXTRACT(EPOCH FROM now() - %s) / $3::float8) ELSE 0 END",
+		current, previous, start)
+	allowed := fmt.Sprintf("(%s) + 1 <= $2::float8", estimate)
+	query := fmt.Sprintf(`
+		INSERT INTO %[1]s AS b (key, tokens, allowed, updated_at, window_start, previous)
+		VALUES ($1, CASE WHEN $2::float8 >= 1 THEN 1 ELSE 0 END, $2::float8 >= 1, now(), %[2]s, 0)
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = %[3]s + CASE WHEN %[5]s THEN 1 ELSE 0 END,
+			previous = %[4]s,
+			allowed = %[5]s,
+			window_start = %[2]s,
+			updated_at = GREATEST(now(), b.updated_at)
+		RETURNING tokens, previous, allowed, EXTRACT(EPOCH FROM now() - window_start)::float8`,
+		s.table, start, current, previous, allowed)
+
+	var count, previousCount, elapsed float64
+	var isAllowed bool
+	err := s.db.QueryRow(ctx, query, key, float64(cfg.Limit), cfg.Window.Seconds(), cfg.Algorithm == SlidingWindow).
+		Scan(&count, &previousCount, &isAllowed, &elapsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count rate limit request: %w", err)
+	}
+
+	return newWindowResult(isAllowed, count, previousCount, time.Duration(elapsed*float64(time.Second)), cfg), nil
+}
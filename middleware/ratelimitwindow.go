@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Algorithm is the rate limiting algorithm of a RateConfig.
+type Algorithm string
+
+const (
+	// TokenBucket allows bursts of up to Burst requests, refilled at Rate per second. It is used if no Algorithm is set.
+	TokenBucket Algorithm = "token_bucket"
+	// FixedWindow allows Limit requests per Window, counted from the start of each Window since the Unix epoch.
+	FixedWindow Algorithm = "fixed_window"
+	// SlidingWindow allows Limit requests in any Window,
+	// approximated by weighing the count of the previous fixed window by how much of it still overlaps.
+	SlidingWindow Algorithm = "sliding_window"
+)
+
+var ErrInvalidRateConfig = errors.New("invalid rate config")
+
+// validate returns an ErrInvalidRateConfig if the Algorithm of c is unknown or its Window is not positive.
+func (c RateConfig) validate() error {
+	switch c.Algorithm {
+	case "", TokenBucket:
+		return nil
+	case FixedWindow, SlidingWindow:
+		if c.Window <= 0 {
+			return fmt.Errorf("%w: window of %s must be positive", ErrInvalidRateConfig, c.Algorithm)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown algorithm %q", ErrInvalidRateConfig, c.Algorithm)
+	}
+}
+
+// windowCounter is the state of a FixedWindow or SlidingWindow bucket of the MemoryLimiterStore.
+type windowCounter struct {
+	cfg      RateConfig
+	start    time.Time
+	count    int
+	previous int
+}
+
+func (c *windowCounter) take(now time.Time) *LimitResult {
+	c.start, c.count, c.previous = c.advance(now)
+
+	elapsed := now.Sub(c.start)
+	allowed := windowEstimate(float64(c.count), float64(c.previous), elapsed, c.cfg)+1 <= float64(c.cfg.Limit)
+	if allowed {
+		c.count++
+	}
+	return newWindowResult(allowed, float64(c.count), float64(c.previous), elapsed, c.cfg)
+}
+
+// advance returns the start of the fixed window holding now, with the counts of it and the one before it.
+func (c *windowCounter) advance(now time.Time) (start time.Time, count, previous int) {
+	start = windowStart(now, c.cfg.Window)
+	switch {
+	case c.start.Equal(start):
+		return start, c.count, c.previous
+	case c.start.Equal(start.Add(-c.cfg.Window)):
+		return start, 0, c.count
+	default:
+		return start, 0, 0
+	}
+}
+
+func (c *windowCounter) limiting(now time.Time) bool {
+	start, count, previous := c.advance(now)
+	return windowEstimate(float64(count), float64(previous), now.Sub(start), c.cfg)+1 > float64(c.cfg.Limit)
+}
+
+// full reports whether the counts have expired, so that dropping the counter does not allow more requests.
+func (c *windowCounter) full(now time.Time) bool {
+	span := c.cfg.Window
+	if c.cfg.Algorithm == SlidingWindow {
+		span *= 2
+	}
+	return !now.Before(c.start.Add(span))
+}
+
+// windowStart returns the start of the fixed window holding now, counted from the Unix epoch as by the
+// PostgresLimiterStore. time.Truncate counts from the zero time instead, which misaligns windows such as 7 days.
+func windowStart(now time.Time, window time.Duration) time.Time {
+	nanos := now.UnixNano()
+	return time.Unix(0, nanos-nanos%int64(window))
+}
+
+// windowEstimate returns the number of requests counted in the window ending now,
+// elapsed into the fixed window holding count, after the one holding previous.
+func windowEstimate(count, previous float64, elapsed time.Duration, cfg RateConfig) float64 {
+	if cfg.Algorithm != SlidingWindow {
+		return count
+	}
+	return count + previous*(1-windowFraction(elapsed, cfg.Window))
+}
+
+func windowFraction(elapsed, window time.Duration) float64 {
+	return min(max(elapsed.Seconds()/window.Seconds(), 0), 1)
+}
+
+// newWindowResult returns the LimitResult of a window bucket configured with cfg, holding count after the request was counted.
+func newWindowResult(allowed bool, count, previous float64, elapsed time.Duration, cfg RateConfig) *LimitResult {
+	limit := float64(cfg.Limit)
+	estimate := windowEstimate(count, previous, elapsed, cfg)
+	result := &LimitResult{
+		Allowed:   allowed,
+		Limit:     cfg.Limit,
+		Remaining: int(math.Floor(max(limit-estimate, 0))),
+	}
+
+	window := cfg.Window.Seconds()
+	untilNext := (1 - windowFraction(elapsed, cfg.Window)) * window
+	sliding := cfg.Algorithm == SlidingWindow
+
+	switch {
+	case count > 0 && sliding:
+		result.ResetAfter = seconds(untilNext + window)
+	case count > 0 || (sliding && previous > 0):
+		result.ResetAfter = seconds(untilNext)
+	}
+
+	if allowed || limit < 1 {
+		return result
+	}
+	switch {
+	case !sliding:
+		result.RetryAfter = seconds(untilNext)
+	case count+1 <= limit:
+		// The previous window slides out until a request fits next to the current count
+		target := 1 - (limit-1-count)/previous
+		result.RetryAfter = seconds((target - windowFraction(elapsed, cfg.Window)) * window)
+	default:
+		// The current count alone is over the limit, it becomes the previous window and slides out from there
+		target := max(1-(limit-1)/count, 0)
+		result.RetryAfter = seconds(untilNext + target*window)
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(max(s, 0) * float64(time.Second))
+}
@@ -42,6 +42,91 @@ func CopyResponseBody(resp *http.Response) string {
 	return string(responseBody)
 }
 
+// PeekRequestBody copies up to limit bytes of the request body and returns them as a string,
+// along with whether the body is longer than limit.
+//
+// It also sets the request body back to its original state, without buffering the remainder of the body.
+// If the request has GetBody, the body is read from a copy and rewound with it instead.
+// A non-positive limit copies the whole body, like CopyRequestBody.
+func PeekRequestBody(req *http.Request, limit int64) (string, bool) {
+	if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+		if body, truncated, ok := peekRewindableBody(req, limit); ok {
+			return body, truncated
+		}
+	}
+	if limit <= 0 {
+		return CopyRequestBody(req), false
+	}
+	if req.Body == nil {
+		return "", false
+	}
+
+	var body string
+	var truncated bool
+	body, truncated, req.Body = peekBody(req.Body, limit)
+	return body, truncated
+}
+
+// PeekResponseBody copies up to limit bytes of the response body and returns them as a string,
+// along with whether the body is longer than limit.
+//
+// It also sets the response body back to its original state, without buffering the remainder of the body.
+// A non-positive limit copies the whole body, like CopyResponseBody.
+func PeekResponseBody(resp *http.Response, limit int64) (string, bool) {
+	if limit <= 0 {
+		return CopyResponseBody(resp), false
+	}
+	if resp.Body == nil {
+		return "", false
+	}
+
+	var body string
+	var truncated bool
+	body, truncated, resp.Body = peekBody(resp.Body, limit)
+	return body, truncated
+}
+
+// peekRewindableBody reads up to limit bytes from a copy of the request body, then replaces it with a fresh copy.
+func peekRewindableBody(req *http.Request, limit int64) (string, bool, bool) {
+	body, err := req.GetBody()
+	if err != nil {
+		return "", false, false
+	}
+
+	reader := io.Reader(body)
+	if limit > 0 {
+		reader = io.LimitReader(body, limit+1)
+	}
+	peeked, _ := io.ReadAll(reader)
+	_ = body.Close()
+
+	rewound, err := req.GetBody()
+	if err != nil {
+		return "", false, false
+	}
+	req.Body = rewound
+
+	if limit > 0 && int64(len(peeked)) > limit {
+		return string(peeked[:limit]), true, true
+	}
+	return string(peeked), false, true
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func peekBody(body io.ReadCloser, limit int64) (string, bool, io.ReadCloser) {
+	peeked, _ := io.ReadAll(io.LimitReader(body, limit+1))
+	restored := &readCloser{Reader: io.MultiReader(bytes.NewReader(peeked), body), Closer: body}
+
+	if int64(len(peeked)) > limit {
+		return string(peeked[:limit]), true, restored
+	}
+	return string(peeked), false, restored
+}
+
 // GetRequestBodyAndValidate reads the request body and validates it.
 //
 // It returns the request body and an error if any.
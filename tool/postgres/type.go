@@ -1,5 +1,12 @@
 package postgres
 
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
 // ConfigProvider is the interface for providing the db configurations.
 type ConfigProvider interface {
 	GetDbUsername() string
@@ -8,3 +15,9 @@ type ConfigProvider interface {
 	GetDbPort() int
 	GetDbDefaultName() string
 }
+
+// IQuerier is the interface for running queries, satisfied by *pgxpool.Pool, *pgx.Conn and pgx.Tx.
+type IQuerier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}